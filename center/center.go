@@ -10,6 +10,8 @@ import (
 
 	"github.com/empirefox/ic-client-one-wrap"
 	"github.com/empirefox/ic-client-one/connector"
+	"github.com/empirefox/ic-client-one/records"
+	"github.com/empirefox/ic-client-one/schedule"
 	"github.com/empirefox/ic-client-one/storage"
 	"github.com/empirefox/ic-client-one/wsio"
 )
@@ -38,8 +40,27 @@ type central struct {
 	localCommand  chan *FromLocalCommand
 	cntrEnt       chan *connector.Event
 	chIdEnt       chan *connector.ChIdEvent
+	reloadSetup   chan struct{}
+	iceRenew      *time.Timer
+	iceRenewAt    time.Time
+	retaining     int32
+	indexing      int32
+	checkingDisk  int32
+	diskMonitor   *records.DiskMonitor
+	diskReport    *records.DiskReport
+	diskEnt       chan *records.DiskReport
+	clips         map[string]*eventClip
+	clipEnd       chan string
+	records       *records.Index
+	schedules     schedule.Schedules
+	schedState    map[string]bool
+	schedTimer    *time.Timer
+	discovering   int32
+	ptz           map[string]*ptzState
+	ptzMu         sync.Mutex
 
 	conf             *storage.Conf
+	store            storage.Store
 	Conductor        rtc.Conductor
 	ConnectorFactory *connector.ConnectorFactory
 	Connectors       *connector.Connectors
@@ -84,10 +105,20 @@ func NewCentral(setup string) (Central, error) {
 		localCommand:  make(chan *FromLocalCommand, 64),
 		cntrEnt:       make(chan *connector.Event, 1),
 		chIdEnt:       make(chan *connector.ChIdEvent, 1),
-
-		quit: make(chan struct{}),
-		conf: conf,
+		reloadSetup:   make(chan struct{}, 1),
+		schedState:    make(map[string]bool),
+		diskEnt:       make(chan *records.DiskReport, 1),
+		clips:         make(map[string]*eventClip),
+		clipEnd:       make(chan string, 1),
+		ptz:           make(map[string]*ptzState),
+
+		quit:    make(chan struct{}),
+		conf:    conf,
+		records: records.NewIndex(conf.GetRecDir()),
 	}
+	low, ok := conf.GetDiskThresholds()
+	center.diskMonitor = records.NewDiskMonitor(conf.GetRecDir(), low, ok)
+	center.diskReport = &records.DiskReport{Status: records.DISK_OK, Dir: conf.GetRecDir()}
 	center.Conductor = rtc.NewConductor(center)
 	center.ConnectorFactory = &connector.ConnectorFactory{
 		Conf:        center.conf,
@@ -105,9 +136,13 @@ func (center *central) preRun() {
 	center.onConnectCtrl()
 	center.Connectors = center.ConnectorFactory.NewConnectors()
 	center.Connectors.Start()
-	for _, stun := range center.conf.GetStuns() {
-		center.Conductor.AddIceServer(stun, "", "")
-	}
+	center.iceRenew = time.NewTimer(time.Hour)
+	center.iceRenew.Stop()
+	center.addIceServers(center.conf.GetIceServers())
+	center.schedTimer = time.NewTimer(time.Hour)
+	center.loadSchedules()
+	go center.updateRecords()
+	go center.checkDisk()
 }
 
 func (center *central) postRun() {
@@ -118,8 +153,23 @@ func (center *central) postRun() {
 func (center *central) run() {
 	glog.Infoln("run")
 	ticker := time.NewTicker(center.conf.GetPingSecond() / 4)
+	var backup <-chan time.Time
+	if interval := center.conf.GetBackupInterval(); interval > 0 {
+		backupTicker := time.NewTicker(interval)
+		defer backupTicker.Stop()
+		backup = backupTicker.C
+	}
+	retentionTicker := time.NewTicker(center.conf.GetRetentionInterval())
+	indexTicker := time.NewTicker(records.INDEX_INTERVAL)
+	diskTicker := time.NewTicker(center.conf.GetDiskCheckInterval())
 	defer func() {
+		retentionTicker.Stop()
+		indexTicker.Stop()
+		diskTicker.Stop()
 		ticker.Stop()
+		center.iceRenew.Stop()
+		center.schedTimer.Stop()
+		center.stopClips()
 	}()
 	for {
 		select {
@@ -161,6 +211,36 @@ func (center *central) run() {
 		case <-ticker.C:
 			center.onConnectCtrl()
 
+		case <-backup:
+			go center.backup()
+
+		case <-retentionTicker.C:
+			go center.enforceRetention()
+
+		case <-indexTicker.C:
+			go center.updateRecords()
+
+		case <-diskTicker.C:
+			go center.checkDisk()
+
+		case r := <-center.diskEnt:
+			center.onDiskStatus(r)
+
+		case id := <-center.clipEnd:
+			center.onClipEnd(id)
+
+		case msg := <-center.ctrlSender:
+			center.sendCtrl(msg)
+
+		case <-center.reloadSetup:
+			center.onReloadSetup(ticker)
+
+		case <-center.iceRenew.C:
+			center.onRenewIceServers()
+
+		case <-center.schedTimer.C:
+			center.onScheduleTimer()
+
 		case <-center.quit:
 			return
 		}
@@ -255,12 +335,12 @@ func (center *central) onConnectorEvnet(e *connector.Event) {
 		case connector.StatusNoChange:
 		case connector.SaveFailed:
 
+		case connector.SaveConflict:
+			center.sendMgrIpcamConflict(e)
+
 		case connector.GetOk:
 			center.sendMgrIpcam(e)
 
-		case connector.IcNotFound:
-			center.sendMgrIpcamNotFound(e)
-
 		case connector.DelOk:
 			center.broadcastDelIpcam(e)
 
@@ -274,26 +354,42 @@ func (center *central) onConnectorEvnet(e *connector.Event) {
 	switch e.Type {
 	case connector.RecChanged:
 		center.sendLocalCamera(e)
+	case connector.DelOk:
+		center.loadSchedules()
 	}
 }
 
 func (center *central) OnIcIdChanged(e *connector.ChIdEvent) { center.chIdEnt <- e }
 func (center *central) onIcIdChanged(e *connector.ChIdEvent) {
+	center.onScheduleIdChanged(e.Old, e.New)
+}
+
+func (center *central) backup() {
+	name, err := center.conf.Backup()
+	if err != nil {
+		glog.Errorln("backup failed:", err)
+		return
+	}
+	glog.Infoln("backup saved:", name)
 }
 
 func (center *central) Start() error {
-	if err := center.conf.Open(); err != nil {
+	store, err := center.conf.OpenStore()
+	if err != nil {
 		return err
 	}
+	center.store = store
+	center.ConnectorFactory.Store = store
 	center.quitWaitGroup.Add(1)
 	go center.start()
+	go center.watchSetup()
 	return nil
 }
 
 func (center *central) start() {
 	defer center.quitWaitGroup.Done()
 	defer func() {
-		center.conf.Close()
+		center.store.Close()
 		center.postRun()
 	}()
 	center.preRun()
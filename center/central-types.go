@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/empirefox/ic-client-one/ipcam"
+	"github.com/empirefox/ic-client-one/onvif"
 	"github.com/empirefox/ic-client-one/storage"
 	"github.com/empirefox/ic-client-one/wsio"
 	"github.com/gin-gonic/gin"
@@ -36,6 +38,7 @@ type Central interface {
 	Start() error
 	Close()
 	ServeLocal(c *gin.Context)
+	ServeRecords(c *gin.Context)
 }
 
 type Socket interface {
@@ -61,3 +64,48 @@ type FromLocalCommand struct {
 func (c *FromLocalCommand) Value() []byte {
 	return bytes.Trim(c.Content, `"`)
 }
+
+type GroupCommand struct {
+	Group string `json:"group"`
+	On    bool   `json:"on,omitempty"`
+}
+
+type HistoryQuery struct {
+	Id    string `json:"id"`
+	Since int64  `json:"since,omitempty"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+type HistoryResult struct {
+	Id    string          `json:"id"`
+	Items []ipcam.History `json:"items"`
+}
+
+type TriggerCommand struct {
+	Id     string `json:"id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Op is one of PTZ_MOVE, PTZ_STOP, PTZ_GOTO, PTZ_SET_PRESET, PTZ_PRESETS.
+type PtzCommand struct {
+	Id string `json:"id"`
+	Op string `json:"op"`
+	// PTZ_MOVE only, seconds to move if no stop follows
+	Velocity onvif.Velocity `json:"velocity"`
+	Timeout  float64        `json:"timeout,omitempty"`
+	// token for PTZ_GOTO, name for PTZ_SET_PRESET
+	Preset string `json:"preset,omitempty"`
+}
+
+type PtzResult struct {
+	Id      string         `json:"id"`
+	Op      string         `json:"op"`
+	Presets []onvif.Preset `json:"presets,omitempty"`
+	Error   string         `json:"error,omitempty"`
+}
+
+type BatchItemResult struct {
+	Id    string `json:"id,omitempty"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
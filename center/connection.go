@@ -29,7 +29,9 @@ func (conn connection) Send(msg []byte) {
 }
 
 func (conn connection) WriteClose() {
-	ticker := time.NewTicker(conn.central.Conf().GetPingSecond())
+	conf := conn.central.Conf()
+	ticker := time.NewTicker(conf.GetPingSecond())
+	pingChanged := conf.PingChanged()
 	defer func() {
 		glog.Infoln("conn closing")
 		if err := recover(); err != nil {
@@ -55,6 +57,10 @@ func (conn connection) WriteClose() {
 				glog.Infoln("conn send ping error", err)
 				return
 			}
+		case <-pingChanged:
+			ticker.Stop()
+			ticker = time.NewTicker(conf.GetPingSecond())
+			pingChanged = conf.PingChanged()
 		case <-conn.quit:
 			return
 		}
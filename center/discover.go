@@ -0,0 +1,132 @@
+package center
+
+import (
+	"encoding/json"
+	"net"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+
+	"github.com/empirefox/ic-client-one/onvif"
+	"github.com/empirefox/ic-client-one/wsio"
+)
+
+var kDiscovered = []byte("Discovered")
+
+// discover runs outside the loop, devices already configured are left out.
+// ok is false when another discovery is running.
+func (center *central) discover() (ds []onvif.Device, ok bool, err error) {
+	if !atomic.CompareAndSwapInt32(&center.discovering, 0, 1) {
+		return nil, false, nil
+	}
+	defer atomic.StoreInt32(&center.discovering, 0)
+
+	found, err := onvif.Discover(onvif.DISCOVERY_TIMEOUT)
+	if err != nil {
+		glog.Errorln("discover ipcams failed:", err)
+	}
+	hosts := make(map[string]bool)
+	for _, i := range center.store.GetIpcams() {
+		if u, err := url.Parse(i.Url); err == nil {
+			hosts[urlHost(u.Host)] = true
+		}
+	}
+	ds = make([]onvif.Device, 0, len(found))
+	for _, d := range found {
+		if !hosts[d.Host()] {
+			ds = append(ds, d)
+		}
+	}
+	return ds, true, err
+}
+
+func urlHost(hostport string) string {
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		return h
+	}
+	return strings.Trim(hostport, "[]")
+}
+
+func (center *central) onManageDiscoverIpcams(cmd *wsio.FromServerCommand) {
+	go func() {
+		ds, ok, err := center.discover()
+		switch {
+		case !ok:
+			center.SendCtrl(cmd.ToManyInfo("Discovery is running"))
+		case err != nil && len(ds) == 0:
+			center.SendCtrl(cmd.ToManyInfo("Discovery failed"))
+		default:
+			center.SendCtrl(cmd.ToManyObj(kDiscovered, ds))
+		}
+	}()
+}
+
+func (center *central) onLocalDiscoverIpcams(cmd *FromLocalCommand) {
+	go func() {
+		ds, ok, _ := center.discover()
+		if !ok {
+			return
+		}
+		msg, _ := json.Marshal(map[string]interface{}{
+			"type":    "Discovered",
+			"content": ds,
+		})
+		cmd.Ws.Send(msg)
+	}()
+}
+
+var kStreams = []byte("Streams")
+
+// StreamsCommand asks the device service at XAddr for its rtsp streams.
+type StreamsCommand struct {
+	XAddr    string `json:"xAddr"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+func (sc *StreamsCommand) streams() ([]onvif.Stream, error) {
+	c := &onvif.Client{XAddr: sc.XAddr, User: sc.User, Password: sc.Password}
+	return c.Streams()
+}
+
+// Content => StreamsCommand
+func (center *central) onManageGetStreams(cmd *wsio.FromServerCommand) {
+	var sc StreamsCommand
+	if err := json.Unmarshal(cmd.Content, &sc); err != nil || sc.XAddr == "" {
+		center.ctrlConn.Send(cmd.ToManyInfo("Cannot parse streams command"))
+		return
+	}
+	go func() {
+		ss, err := sc.streams()
+		if err != nil {
+			glog.Errorln("get streams failed:", err)
+			center.SendCtrl(cmd.ToManyInfo("Get streams failed: " + err.Error()))
+			return
+		}
+		center.SendCtrl(cmd.ToManyObj(kStreams, ss))
+	}()
+}
+
+// Content => StreamsCommand
+func (center *central) onLocalGetStreams(cmd *FromLocalCommand) {
+	var sc StreamsCommand
+	if err := json.Unmarshal(cmd.Content, &sc); err != nil || sc.XAddr == "" {
+		glog.Errorln("bad streams command:", err)
+		return
+	}
+	go func() {
+		content := map[string]interface{}{"xAddr": sc.XAddr}
+		if ss, err := sc.streams(); err != nil {
+			content["error"] = err.Error()
+		} else {
+			content["streams"] = ss
+		}
+		msg, _ := json.Marshal(map[string]interface{}{
+			"type":    "Streams",
+			"content": content,
+		})
+		cmd.Ws.Send(msg)
+	}()
+}
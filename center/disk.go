@@ -0,0 +1,53 @@
+package center
+
+import (
+	"sync/atomic"
+
+	"github.com/golang/glog"
+
+	"github.com/empirefox/ic-client-one/records"
+	"github.com/empirefox/ic-client-one/wsio"
+)
+
+var kDisk = []byte("Disk")
+
+var diskStatuses = map[string][]byte{
+	records.DISK_OK:         DISK_OK,
+	records.DISK_LOW:        DISK_LOW,
+	records.REC_WRITE_ERROR: REC_WRITE_ERROR,
+}
+
+// checkDisk runs outside the loop, only changes are sent back.
+func (center *central) checkDisk() {
+	if !atomic.CompareAndSwapInt32(&center.checkingDisk, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&center.checkingDisk, 0)
+
+	m := center.diskMonitor
+	m.LowBytes, m.OkBytes = center.conf.GetDiskThresholds()
+	if r, changed := m.Check(); changed {
+		select {
+		case center.diskEnt <- r:
+		case <-center.quit:
+		}
+	}
+}
+
+func (center *central) onDiskStatus(r *records.DiskReport) {
+	if r.Status == records.DISK_OK {
+		glog.Infoln("disk is ok again:", r.Dir)
+	} else {
+		glog.Errorf("disk status %s, dir: %s, free: %d, err: %s\n", r.Status, r.Dir, r.Free, r.Error)
+	}
+	center.diskReport = r
+	center.onChangeNoStatus(diskStatuses[r.Status])
+	center.sendCtrl(wsio.BcObj(kDisk, r))
+}
+
+// sendDiskAlert tells a new ctrl connection about an ongoing problem.
+func (center *central) sendDiskAlert() {
+	if center.diskReport.Status != records.DISK_OK {
+		center.sendCtrl(wsio.BcObj(kDisk, center.diskReport))
+	}
+}
@@ -0,0 +1,137 @@
+package center
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/empirefox/ic-client-one/connector"
+	"github.com/empirefox/ic-client-one/records"
+	"github.com/empirefox/ic-client-one/wsio"
+)
+
+const defaultEventReason = "manual"
+
+var kEvRec = []byte("EventRec")
+
+// eventClip is an ongoing event recording. It starts pre-roll before the
+// trigger only when the camera was recording already, the native recorder
+// keeps no frames while it is off.
+type eventClip struct {
+	event     records.Event
+	triggered time.Time
+	timer     *time.Timer
+}
+
+type eventRecStatus struct {
+	records.Event
+	Active bool `json:"active"`
+}
+
+// triggerRec starts an event clip of id, or extends the ongoing one.
+// A trigger after the clip reached EventMaxSecond starts a new clip.
+func (center *central) triggerRec(id, reason string) (*records.Event, error) {
+	i, err := center.store.GetIpcam([]byte(id))
+	if err != nil {
+		return nil, err
+	}
+	if reason == "" {
+		reason = defaultEventReason
+	}
+	pre, post, max := center.conf.GetEventRoll()
+	now := time.Now()
+
+	recording := i.Rec || center.schedState[id]
+	clip, ok := center.clips[id]
+	if ok && !now.Before(clip.triggered.Add(max)) {
+		clip.timer.Stop()
+		delete(center.clips, id)
+		center.sendEventRec(&eventRecStatus{clip.event, false})
+		recording, ok = true, false
+	}
+	if !ok {
+		start := now
+		if recording {
+			start = now.Add(-pre)
+		}
+		clip = &eventClip{
+			event:     records.Event{Camera: id, Start: start.Unix()},
+			triggered: now,
+			timer: time.AfterFunc(post, func() {
+				select {
+				case center.clipEnd <- id:
+				case <-center.quit:
+				}
+			}),
+		}
+		center.clips[id] = clip
+		center.Connectors.SetRecBy(id, connector.RecByEvent, true)
+	}
+	end := now.Add(post)
+	if limit := clip.triggered.Add(max); end.After(limit) {
+		end = limit
+	}
+	clip.event.End = end.Unix()
+	clip.event.AddReason(reason)
+	clip.timer.Reset(end.Sub(now))
+
+	if err := center.records.PutEvent(clip.event); err != nil {
+		glog.Errorln("save event failed:", err)
+	}
+	center.sendEventRec(&eventRecStatus{clip.event, true})
+	return &clip.event, nil
+}
+
+func (center *central) onClipEnd(id string) {
+	clip, ok := center.clips[id]
+	if !ok || time.Now().Unix() < clip.event.End {
+		// extended after the timer fired
+		return
+	}
+	delete(center.clips, id)
+	center.Connectors.SetRecBy(id, connector.RecByEvent, false)
+	center.sendEventRec(&eventRecStatus{clip.event, false})
+}
+
+func (center *central) stopClips() {
+	for _, clip := range center.clips {
+		clip.timer.Stop()
+	}
+}
+
+func (center *central) sendEventRec(status *eventRecStatus) {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "EventRec",
+		"content": status,
+	})
+	center.onChangeNoStatus(msg)
+	center.sendCtrl(wsio.BcObj(kEvRec, status))
+}
+
+// Content => TriggerCommand
+func (center *central) onManageTriggerRec(cmd *wsio.FromServerCommand) {
+	var data TriggerCommand
+	if err := json.Unmarshal(cmd.Value(), &data); err != nil || data.Id == "" {
+		center.ctrlConn.Send(cmd.ToManyInfo("Cannot parse trigger command"))
+		return
+	}
+	e, err := center.triggerRec(data.Id, data.Reason)
+	if err != nil {
+		center.ctrlConn.Send(cmd.ToManyInfo("Trigger failed: " + err.Error()))
+		return
+	}
+	center.ctrlConn.Send(cmd.ToManyObj(kEvRec, &eventRecStatus{*e, true}))
+}
+
+// Content => TriggerCommand
+func (center *central) onLocalTriggerRec(cmd *FromLocalCommand) {
+	var data TriggerCommand
+	if err := json.Unmarshal(cmd.Content, &data); err != nil || data.Id == "" {
+		glog.Errorln("bad trigger command:", string(cmd.Content))
+		return
+	}
+	if _, err := center.triggerRec(data.Id, data.Reason); err != nil {
+		glog.Errorln(err)
+	}
+}
@@ -0,0 +1,63 @@
+package center
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/empirefox/ic-client-one/connector"
+	"github.com/empirefox/ic-client-one/ipcam"
+	"github.com/empirefox/ic-client-one/records"
+	"github.com/empirefox/ic-client-one/storage"
+)
+
+func TestCentral_TriggerRecAfterMax(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ic-client-one-event-")
+	defer os.RemoveAll(dir)
+	conf, err := storage.NewConf(fmt.Sprintf(`{
+		"DbPath": ":memory:",
+		"RecDir": "%s",
+		"WsUrl": "ws://127.0.0.1:9998",
+		"PingSecond": 50,
+		"EventPostSecond": 30,
+		"EventMaxSecond": 60
+	}`, dir))
+	if err != nil {
+		t.Fatalf("NewConf failed, err: %v\n", err)
+	}
+	store := storage.NewMemStore(0)
+	store.PutIpcam(&ipcam.Ipcam{Id: "a", Url: "rtsp://a"})
+	center := &central{
+		conf:       conf,
+		store:      store,
+		records:    records.NewIndex(dir),
+		clips:      make(map[string]*eventClip),
+		clipEnd:    make(chan string, 1),
+		schedState: make(map[string]bool),
+		quit:       make(chan struct{}),
+		// no connectors, recording is not switched
+		Connectors: (&connector.ConnectorFactory{Store: storage.NewMemStore(0)}).NewConnectors(),
+	}
+	defer center.stopClips()
+
+	first, err := center.triggerRec("a", "door")
+	if err != nil {
+		t.Fatalf("trigger failed, err: %v\n", err)
+	}
+	firstStart := first.Start
+	// the clip reached EventMaxSecond
+	center.clips["a"].triggered = time.Now().Add(-time.Hour)
+
+	e, err := center.triggerRec("a", "door")
+	if err != nil {
+		t.Fatalf("trigger failed, err: %v\n", err)
+	}
+	if now := time.Now().Unix(); e.Start == firstStart || e.Start > now || e.End < now+29 {
+		t.Errorf("trigger after max should start a clip with its own post-roll, got: %+v\n", e)
+	}
+	if clip := center.clips["a"]; time.Since(clip.triggered) > time.Minute {
+		t.Errorf("the new clip should replace the capped one\n")
+	}
+}
@@ -0,0 +1,56 @@
+package center
+
+import (
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/empirefox/ic-client-one/storage"
+)
+
+// addIceServers adds every url of the servers to the conductor, and
+// schedules a renewal before the earliest minted credential expires.
+func (center *central) addIceServers(servers []storage.IceServer) {
+	now := time.Now()
+	for _, s := range servers {
+		username, credential, expires := s.Credentials(now)
+		for _, u := range s.Urls {
+			center.Conductor.AddIceServer(u, username, credential)
+		}
+		if !expires.IsZero() {
+			// renew at 80% of ttl
+			center.scheduleIceRenew(now.Add(s.Ttl() * 4 / 5))
+		}
+	}
+}
+
+func (center *central) scheduleIceRenew(at time.Time) {
+	if !center.iceRenewAt.IsZero() && !at.Before(center.iceRenewAt) {
+		return
+	}
+	center.iceRenewAt = at
+	center.iceRenew.Stop()
+	center.iceRenew.Reset(at.Sub(time.Now()))
+}
+
+// iceServerClearer is implemented by conductors that can drop the ice
+// servers added before. Renewing turn credentials needs it.
+type iceServerClearer interface {
+	ClearIceServers()
+}
+
+// onRenewIceServers replaces every server, so the ones with expired
+// credentials are not kept. Without ClearIceServers nothing is renewed,
+// re-adding would grow the conductor list for as long as we run.
+func (center *central) onRenewIceServers() {
+	center.iceRenewAt = time.Time{}
+	clearer, ok := center.Conductor.(iceServerClearer)
+	if !ok {
+		glog.Warningln("conductor cannot replace ice servers, turn credentials are not renewed")
+		return
+	}
+	servers := center.conf.GetIceServers()
+	glog.Infoln("renewing turn credentials, ice servers:", len(servers))
+	clearer.ClearIceServers()
+	center.addIceServers(servers)
+}
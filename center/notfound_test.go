@@ -0,0 +1,45 @@
+package center
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/empirefox/ic-client-one/connector"
+	"github.com/empirefox/ic-client-one/storage"
+	"github.com/empirefox/ic-client-one/wsio"
+)
+
+type sendWs struct {
+	Socket
+	sent chan []byte
+}
+
+func (ws *sendWs) Send(msg []byte) { ws.sent <- msg }
+func (ws *sendWs) WriteClose()     {}
+
+func TestCentral_NotFoundWithFullEvents(t *testing.T) {
+	center := &central{cntrEnt: make(chan *connector.Event, 1)}
+	f := &connector.ConnectorFactory{Store: storage.NewMemStore(0), OnEvent: center.OnConnectorEvnet}
+	center.Connectors = f.NewConnectors()
+	ws := &sendWs{sent: make(chan []byte, 1)}
+	center.ctrlConn = ws
+	// a connector event waits for the loop
+	center.cntrEnt <- &connector.Event{}
+
+	for _, name := range []string{"ManageGetIpcam", "ManageDelIpcam", "ManageReconnectIpcam"} {
+		done := make(chan struct{})
+		go func(cmd *wsio.FromServerCommand) {
+			center.onServerCommand(cmd)
+			close(done)
+		}(&wsio.FromServerCommand{Name: name, Content: []byte(`"none"`)})
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("%s of unknown id should not block the loop\n", name)
+		}
+		if msg := <-ws.sent; !bytes.Contains(msg, kNoIc) || !bytes.HasSuffix(msg, []byte("none")) {
+			t.Errorf("%s should reply not found, got: %s\n", name, msg)
+		}
+	}
+}
@@ -52,11 +52,38 @@ func (center *central) onLocalCommand(cmd *FromLocalCommand) {
 	switch cmd.Type {
 	case "GetStatus":
 		cmd.Ws.Send(center.status)
+		cmd.Ws.Send(diskStatuses[center.diskReport.Status])
 	case "GetRoomInfo":
 		center.onGetRoomInfo(cmd.Ws)
 		center.onGetLocalCameras()
 	case "GetCameras":
 		center.onGetLocalCameras()
+	case "GetCameraHistory":
+		center.onGetLocalCameraHistory(cmd)
+	case "GetGroups":
+		center.onGetLocalGroups(cmd.Ws)
+	case "SetGroupRecOn":
+		center.Connectors.SetGroupRec(string(cmd.Value()), true)
+	case "SetGroupRecOff":
+		center.Connectors.SetGroupRec(string(cmd.Value()), false)
+	case "GetSchedules":
+		center.sendLocalSchedules(cmd.Ws)
+	case "SetSchedule":
+		center.onLocalSetSchedule(cmd)
+	case "DelSchedule":
+		center.onLocalDelSchedule(cmd)
+	case "RetryNow":
+		center.Connectors.RetryNow(string(cmd.Value()))
+	case "TriggerRec":
+		center.onLocalTriggerRec(cmd)
+	case "ListRecords":
+		center.onLocalListRecords(cmd)
+	case "DiscoverIpcams":
+		center.onLocalDiscoverIpcams(cmd)
+	case "GetStreams":
+		center.onLocalGetStreams(cmd)
+	case "Ptz":
+		center.onLocalPtz(cmd)
 	case "DoConnect":
 		center.onConnectCtrl()
 	case "DoLogin":
@@ -111,8 +138,43 @@ func (center *central) sendLocalCamera(e *connector.Event) {
 	center.onChangeNoStatus(msg)
 }
 
+func (center *central) onGetLocalGroups(ws Ws) {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "Groups",
+		"content": center.store.GetIpcams().Groups(),
+	})
+	ws.Send(msg)
+}
+
+// Content => HistoryQuery
+func (center *central) onGetLocalCameraHistory(cmd *FromLocalCommand) {
+	var q HistoryQuery
+	if err := json.Unmarshal(cmd.Content, &q); err != nil {
+		glog.Errorln(err)
+		return
+	}
+	hs, err := center.getIpcamHistory(&q)
+	if err != nil {
+		glog.Errorln(err)
+		return
+	}
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "CameraHistory",
+		"content": hs,
+	})
+	cmd.Ws.Send(msg)
+}
+
+func (center *central) getIpcamHistory(q *HistoryQuery) (*HistoryResult, error) {
+	items, err := center.store.GetIpcamHistory(q.Id, q.Since, q.Limit)
+	if err != nil {
+		return nil, err
+	}
+	return &HistoryResult{Id: q.Id, Items: items}, nil
+}
+
 func (center *central) onGetRegable() {
-	token := center.conf.GetRegToken()
+	token := center.store.Get(storage.K_REG_TOKEN)
 	if bytes.Count(token, []byte{'.'}) != 2 {
 		center.onChangeNoStatus(BAD_REG_TOKEN)
 		return
@@ -121,7 +183,7 @@ func (center *central) onGetRegable() {
 }
 
 func (center *central) onSetRegToken(token []byte) {
-	if err := center.conf.Put(storage.K_REG_TOKEN, token); err != nil {
+	if err := center.store.Put(storage.K_REG_TOKEN, token); err != nil {
 		center.onChangeNoStatus(SAVE_REG_TOKEN_ERROR)
 		return
 	}
@@ -129,7 +191,7 @@ func (center *central) onSetRegToken(token []byte) {
 }
 
 func (center *central) onDoRemoveRegToken() {
-	center.conf.Del(storage.K_REG_TOKEN)
+	center.store.Del(storage.K_REG_TOKEN)
 	center.onChangeNoStatus(BAD_REG_TOKEN)
 	center.onStatusChange(nil)
 }
@@ -138,7 +200,7 @@ func (center *central) onRegRoom(nameJson []byte) {
 	pre := center.status
 	if center.hasCtrl {
 		center.onStatusChange(REGGING)
-		center.ctrlConn.Send([]byte(fmt.Sprintf(`one:RegRoom:%s:%s`, center.conf.GetRegToken(), nameJson)))
+		center.ctrlConn.Send([]byte(fmt.Sprintf(`one:RegRoom:%s:%s`, center.store.Get(storage.K_REG_TOKEN), nameJson)))
 	} else {
 		center.onStatusChange(DISCONNECTED)
 	}
@@ -12,12 +12,16 @@ import (
 )
 
 var (
-	kIcIds  = []byte("IcIds")
-	kIc     = []byte("Ic")
-	kIcIdCh = []byte("IcIdCh")
-	kXIc    = []byte("XIc")
-	kSecIc  = []byte("SecIc")
-	kNoIc   = []byte("NoIc")
+	kIcIds   = []byte("IcIds")
+	kIc      = []byte("Ic")
+	kIcIdCh  = []byte("IcIdCh")
+	kXIc     = []byte("XIc")
+	kSecIc   = []byte("SecIc")
+	kNoIc    = []byte("NoIc")
+	kIcHis   = []byte("IcHis")
+	kIcConf  = []byte("IcConflict")
+	kGroups  = []byte("Groups")
+	kIcBatch = []byte("IcBatch")
 )
 
 func (center *central) readCtrl(c Ws) {
@@ -56,6 +60,52 @@ func (center *central) onServerCommand(cmd *wsio.FromServerCommand) {
 	case "ManageDelIpcam":
 		center.onManageDelIpcam(cmd)
 
+	case "ManageSetIpcams":
+		center.onManageSetIpcams(cmd)
+
+	case "ManageDelIpcams":
+		center.onManageDelIpcams(cmd)
+
+	case "ManageReconnectIpcam":
+		center.onManageReconnectIpcam(cmd)
+
+	case "ManageRetryIpcam":
+		center.onManageRetryIpcam(cmd)
+
+	case "ManageGetIpcamHistory":
+		center.onManageGetIpcamHistory(cmd)
+
+	case "ManageGetGroups":
+		center.onManageGetGroups(cmd)
+
+	case "ManageSetGroupRec":
+		center.onManageSetGroupRec(cmd)
+
+	case "ManageSetGroupOff":
+		center.onManageSetGroupOff(cmd)
+
+	case "ManageGetSchedules":
+		center.onManageGetSchedules(cmd)
+
+	case "ManageSetSchedule":
+		center.onManageSetSchedule(cmd)
+
+	case "ManageDelSchedule":
+		center.onManageDelSchedule(cmd)
+
+	case "TriggerRec":
+		center.onManageTriggerRec(cmd)
+
+	case "ManageListRecords":
+		center.onManageListRecords(cmd)
+
+	case "ManageDiscoverIpcams":
+		center.onManageDiscoverIpcams(cmd)
+	case "ManageGetStreams":
+		center.onManageGetStreams(cmd)
+	case "ManagePtz":
+		center.onManagePtz(cmd)
+
 	case "CreateSignalingConnection":
 		go center.OnCreateSignalingConnection(cmd)
 
@@ -63,14 +113,14 @@ func (center *central) onServerCommand(cmd *wsio.FromServerCommand) {
 		center.onViewRoom(cmd)
 
 	case "BadRoomToken":
-		//		center.conf.Del(storage.K_ROOM_TOKEN)
+		//		center.store.Del(storage.K_ROOM_TOKEN)
 		center.onStatusChange(BAD_ROOM_TOKEN)
 
 	case "SetRoomToken":
 		center.onSetRoomToken(cmd)
 
 	case "BadRegToken":
-		center.conf.Del(storage.K_REG_TOKEN)
+		center.store.Del(storage.K_REG_TOKEN)
 		center.onChangeNoStatus(BAD_REG_TOKEN)
 
 	case "RegError":
@@ -84,6 +134,7 @@ func (center *central) onViewRoom(cmd *wsio.FromServerCommand) {
 	center.onStatusChange(READY)
 	center.ctrlConn.Send(cmd.ToManyObj(kIcIds, center.Connectors.Ids()))
 	center.Connectors.ViewRoom(cmd)
+	center.sendDiskAlert()
 }
 func (center *central) sendViewIpcam(e *connector.Event) {
 	center.ctrlConn.Send(e.Cmd.ToManyObj(kIc, e.Ic.Map(ipcam.TAG_VIEW)))
@@ -96,7 +147,95 @@ func (center *central) onManageSetIpcam(cmd *wsio.FromServerCommand) {
 		center.ctrlConn.Send(cmd.ToManyInfo("Cannot parse ipcam"))
 		return
 	}
-	center.Connectors.Save(cmd, data)
+	if !center.needUrlCheck(&data) {
+		center.Connectors.Save(cmd, data)
+		return
+	}
+	go func() {
+		if err := checkUrl(data.Url); err != nil {
+			center.SendCtrl(cmd.ToManyInfo("Url check failed: " + err.Error()))
+			return
+		}
+		center.Connectors.Save(cmd, data)
+	}()
+}
+
+// Content => []SetterIpcam, saved all or nothing
+func (center *central) onManageSetIpcams(cmd *wsio.FromServerCommand) {
+	var setters []ipcam.SetterIpcam
+	if err := json.Unmarshal(cmd.Content, &setters); err != nil || len(setters) == 0 {
+		center.ctrlConn.Send(cmd.ToManyInfo("Cannot parse ipcams"))
+		return
+	}
+	ids := make([]string, len(setters))
+	check := make([]bool, len(setters))
+	var checks int
+	for k, s := range setters {
+		ids[k] = s.Id
+		if ids[k] == "" {
+			ids[k] = s.Target
+		}
+		if check[k] = center.needUrlCheck(&setters[k]); check[k] {
+			checks++
+		}
+	}
+	if checks == 0 {
+		center.saveIpcams(cmd, ids, setters, center.ctrlConn.Send)
+		return
+	}
+	go func() {
+		if err := checkUrls(setters, check); err != nil {
+			center.SendCtrl(cmd.ToManyObj(kIcBatch, batchResults(ids, err)))
+			return
+		}
+		center.saveIpcams(cmd, ids, setters, center.SendCtrl)
+	}()
+}
+
+// saveIpcams may run outside the loop with send = SendCtrl.
+func (center *central) saveIpcams(cmd *wsio.FromServerCommand, ids []string, setters []ipcam.SetterIpcam, send func([]byte)) {
+	err := center.store.SaveIpcams(setters)
+	send(cmd.ToManyObj(kIcBatch, batchResults(ids, err)))
+	if err == nil {
+		center.Connectors.SaveStored(cmd, setters)
+	}
+}
+
+// Content => []Ipcam.Id, removed all or nothing
+func (center *central) onManageDelIpcams(cmd *wsio.FromServerCommand) {
+	var ids []string
+	if err := json.Unmarshal(cmd.Content, &ids); err != nil || len(ids) == 0 {
+		center.ctrlConn.Send(cmd.ToManyInfo("Cannot parse ipcam ids"))
+		return
+	}
+	err := center.store.RemoveIpcams(ids)
+	center.ctrlConn.Send(cmd.ToManyObj(kIcBatch, batchResults(ids, err)))
+	if err == nil {
+		center.Connectors.RemovedStored(cmd, ids)
+	}
+}
+
+func batchResults(ids []string, err error) []BatchItemResult {
+	rs := make([]BatchItemResult, len(ids))
+	be, isBatch := err.(*storage.BatchError)
+	for k, id := range ids {
+		rs[k] = BatchItemResult{Id: id, Ok: err == nil}
+		switch {
+		case err == nil:
+		case !isBatch:
+			rs[k].Error = err.Error()
+		case be.Errs[k] != nil:
+			rs[k].Error = be.Errs[k].Error()
+		default:
+			rs[k].Error = "not saved, other items failed"
+		}
+	}
+	return rs
+}
+
+// reply the current ipcam to the editor, so it can merge
+func (center *central) sendMgrIpcamConflict(e *connector.Event) {
+	center.ctrlConn.Send(e.Cmd.ToManyObj(kIcConf, e.Ic.Map()))
 }
 func (center *central) sendChIcId(e *connector.ChIdEvent) {
 	center.ctrlConn.Send(wsio.BcObj(kIcIdCh, e))
@@ -104,25 +243,91 @@ func (center *central) sendChIcId(e *connector.ChIdEvent) {
 
 // Content => id
 func (center *central) onManageGetIpcam(cmd *wsio.FromServerCommand) {
-	center.Connectors.Get(cmd, string(cmd.Value()))
+	id := string(cmd.Value())
+	if !center.Connectors.Get(cmd, id) {
+		center.sendMgrIpcamNotFound(cmd, id)
+	}
 }
 func (center *central) sendMgrIpcam(e *connector.Event) {
 	center.ctrlConn.Send(e.Cmd.ToManyObj(kSecIc, e.Ic.Map()))
 }
-func (center *central) sendMgrIpcamNotFound(e *connector.Event) {
-	center.ctrlConn.Send(e.Cmd.ToManyJSON(kNoIc, []byte(e.Ic.Id)))
+
+// replied from the loop, connector events would wait for the loop itself
+func (center *central) sendMgrIpcamNotFound(cmd *wsio.FromServerCommand, id string) {
+	center.ctrlConn.Send(cmd.ToManyJSON(kNoIc, []byte(id)))
 }
 
 // Content => Ipcam.Id
 func (center *central) onManageDelIpcam(cmd *wsio.FromServerCommand) {
-	center.Connectors.Del(cmd, string(cmd.Value()))
+	id := string(cmd.Value())
+	if !center.Connectors.Del(cmd, id) {
+		center.sendMgrIpcamNotFound(cmd, id)
+	}
 }
 func (center *central) broadcastDelIpcam(e *connector.Event) {
 	center.ctrlConn.Send(wsio.BcJSON(kXIc, []byte(e.Ic.Id)))
 }
 
+// Content => Ipcam.Id, empty for every ipcam
+func (center *central) onManageReconnectIpcam(cmd *wsio.FromServerCommand) {
+	id := string(cmd.Value())
+	if !center.Connectors.Reconnect(cmd, id) {
+		center.sendMgrIpcamNotFound(cmd, id)
+	}
+}
+
+// Content => Ipcam.Id, empty for every offline ipcam
+func (center *central) onManageRetryIpcam(cmd *wsio.FromServerCommand) {
+	id := string(cmd.Value())
+	if !center.Connectors.RetryNow(id) {
+		center.sendMgrIpcamNotFound(cmd, id)
+		return
+	}
+	center.ctrlConn.Send(cmd.ToManyInfo("Retrying: " + id))
+}
+
+// Content => HistoryQuery
+func (center *central) onManageGetIpcamHistory(cmd *wsio.FromServerCommand) {
+	var q HistoryQuery
+	if err := json.Unmarshal(cmd.Value(), &q); err != nil {
+		center.ctrlConn.Send(cmd.ToManyInfo("Cannot parse history query"))
+		return
+	}
+	hs, err := center.getIpcamHistory(&q)
+	if err != nil {
+		center.ctrlConn.Send(cmd.ToManyInfo("Get history failed: " + q.Id))
+		return
+	}
+	center.ctrlConn.Send(cmd.ToManyObj(kIcHis, hs))
+}
+
+func (center *central) onManageGetGroups(cmd *wsio.FromServerCommand) {
+	center.ctrlConn.Send(cmd.ToManyObj(kGroups, center.store.GetIpcams().Groups()))
+}
+
+// Content => GroupCommand
+func (center *central) onManageSetGroupRec(cmd *wsio.FromServerCommand) {
+	var data GroupCommand
+	if err := json.Unmarshal(cmd.Value(), &data); err != nil || data.Group == "" {
+		center.ctrlConn.Send(cmd.ToManyInfo("Cannot parse group command"))
+		return
+	}
+	center.Connectors.SetGroupRec(data.Group, data.On)
+	center.ctrlConn.Send(cmd.ToManyInfo("Group recording changed: " + data.Group))
+}
+
+// Content => GroupCommand, On means Off
+func (center *central) onManageSetGroupOff(cmd *wsio.FromServerCommand) {
+	var data GroupCommand
+	if err := json.Unmarshal(cmd.Value(), &data); err != nil || data.Group == "" {
+		center.ctrlConn.Send(cmd.ToManyInfo("Cannot parse group command"))
+		return
+	}
+	center.Connectors.SetGroupOff(cmd, data.Group, data.On)
+}
+
 func (center *central) onSetRoomToken(cmd *wsio.FromServerCommand) {
-	if err := center.conf.Put(storage.K_ROOM_TOKEN, cmd.Value()); err != nil {
+	if err := center.store.Put(storage.K_ROOM_TOKEN, cmd.Value()); err != nil {
 		center.onStatusChange(SAVE_ROOM_TOKEN_ERROR)
 		return
 	}
@@ -130,7 +335,7 @@ func (center *central) onSetRoomToken(cmd *wsio.FromServerCommand) {
 }
 
 func (center *central) onDoLogin() {
-	token := center.conf.GetRoomToken()
+	token := center.store.Get(storage.K_ROOM_TOKEN)
 	if bytes.Count(token, []byte{'.'}) != 2 {
 		center.onStatusChange(BAD_ROOM_TOKEN)
 		return
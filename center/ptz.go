@@ -0,0 +1,166 @@
+package center
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/empirefox/ic-client-one/onvif"
+	"github.com/empirefox/ic-client-one/wsio"
+)
+
+const (
+	PTZ_MOVE       = "move"
+	PTZ_STOP       = "stop"
+	PTZ_GOTO       = "goto"
+	PTZ_SET_PRESET = "setPreset"
+	PTZ_PRESETS    = "presets"
+
+	// moves and gotos of a camera closer than this are rejected
+	PTZ_MOVE_INTERVAL = 250 * time.Millisecond
+	// a lost stop does not leave the camera moving
+	PTZ_MOVE_TIMEOUT = 5 * time.Second
+)
+
+var (
+	kPtz = []byte("Ptz")
+
+	ErrPtzTooFast   = errors.New("PTZ commands too fast")
+	ErrPtzBadOp     = errors.New("Unknown PTZ op")
+	ErrPtzNoPreset  = errors.New("PTZ preset required")
+	ErrPtzNotManage = errors.New("PTZ needs manage rights")
+)
+
+// ptzState caches the PTZ service of a camera, guarded by ptzMu.
+type ptzState struct {
+	onvif    string
+	url      string
+	ptz      *onvif.PTZ
+	lastMove time.Time
+}
+
+// ptzCommand checks pc in the loop, then calls the camera outside.
+func (center *central) ptzCommand(pc *PtzCommand, done func(*PtzResult)) {
+	result := &PtzResult{Id: pc.Id, Op: pc.Op}
+	fail := func(err error) {
+		result.Error = err.Error()
+		done(result)
+	}
+	switch pc.Op {
+	case PTZ_MOVE, PTZ_STOP, PTZ_PRESETS:
+	case PTZ_GOTO, PTZ_SET_PRESET:
+		if pc.Preset == "" {
+			fail(ErrPtzNoPreset)
+			return
+		}
+	default:
+		fail(ErrPtzBadOp)
+		return
+	}
+	i, err := center.store.GetIpcam([]byte(pc.Id))
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	center.ptzMu.Lock()
+	st, ok := center.ptz[pc.Id]
+	if !ok || st.url != i.Url || st.onvif != i.Onvif {
+		st = &ptzState{onvif: i.Onvif, url: i.Url}
+		center.ptz[pc.Id] = st
+	}
+	if pc.Op == PTZ_MOVE || pc.Op == PTZ_GOTO {
+		now := time.Now()
+		if now.Sub(st.lastMove) < PTZ_MOVE_INTERVAL {
+			center.ptzMu.Unlock()
+			fail(ErrPtzTooFast)
+			return
+		}
+		st.lastMove = now
+	}
+	p := st.ptz
+	center.ptzMu.Unlock()
+
+	go func() {
+		if p == nil {
+			c, err := onvif.NewClient(st.onvif, st.url)
+			if err == nil {
+				p, err = c.PTZ()
+			}
+			if err != nil {
+				fail(err)
+				return
+			}
+			center.ptzMu.Lock()
+			st.ptz = p
+			center.ptzMu.Unlock()
+		}
+		if err := center.doPtz(p, pc, result); err != nil {
+			glog.Errorln("ptz", pc.Op, pc.Id, "failed:", err)
+			// resolve again next time, the camera may be changed
+			center.ptzMu.Lock()
+			st.ptz = nil
+			center.ptzMu.Unlock()
+			fail(err)
+			return
+		}
+		done(result)
+	}()
+}
+
+func (center *central) doPtz(p *onvif.PTZ, pc *PtzCommand, result *PtzResult) (err error) {
+	switch pc.Op {
+	case PTZ_MOVE:
+		timeout := time.Duration(pc.Timeout * float64(time.Second))
+		if timeout <= 0 || timeout > PTZ_MOVE_TIMEOUT {
+			timeout = PTZ_MOVE_TIMEOUT
+		}
+		return p.ContinuousMove(pc.Velocity, timeout)
+	case PTZ_STOP:
+		return p.Stop()
+	case PTZ_GOTO:
+		return p.GotoPreset(pc.Preset)
+	case PTZ_SET_PRESET:
+		var token string
+		if token, err = p.SetPreset(pc.Preset); err == nil {
+			result.Presets = []onvif.Preset{{Token: token, Name: pc.Preset}}
+		}
+		return err
+	}
+	result.Presets, err = p.Presets()
+	return err
+}
+
+// Content => PtzCommand, only managers(cmd.From != 0) can use it
+func (center *central) onManagePtz(cmd *wsio.FromServerCommand) {
+	if cmd.From == 0 {
+		center.ctrlConn.Send(cmd.ToManyInfo(ErrPtzNotManage.Error()))
+		return
+	}
+	var pc PtzCommand
+	if err := json.Unmarshal(cmd.Content, &pc); err != nil || pc.Id == "" {
+		center.ctrlConn.Send(cmd.ToManyInfo("Cannot parse ptz command"))
+		return
+	}
+	center.ptzCommand(&pc, func(r *PtzResult) {
+		center.SendCtrl(cmd.ToManyObj(kPtz, r))
+	})
+}
+
+// Content => PtzCommand
+func (center *central) onLocalPtz(cmd *FromLocalCommand) {
+	var pc PtzCommand
+	if err := json.Unmarshal(cmd.Content, &pc); err != nil || pc.Id == "" {
+		glog.Errorln("bad ptz command:", string(cmd.Content))
+		return
+	}
+	center.ptzCommand(&pc, func(r *PtzResult) {
+		msg, _ := json.Marshal(map[string]interface{}{
+			"type":    "Ptz",
+			"content": r,
+		})
+		cmd.Ws.Send(msg)
+	})
+}
@@ -0,0 +1,23 @@
+package center
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/empirefox/ic-client-one/wsio"
+)
+
+func TestCentral_ManagePtzNeedsRights(t *testing.T) {
+	ws := &sendWs{sent: make(chan []byte, 1)}
+	center := &central{ctrlConn: ws, ctrlSender: make(chan []byte, 1)}
+
+	center.onServerCommand(&wsio.FromServerCommand{Name: "ManagePtz", Content: []byte(`{"id":"a","op":"stop"}`)})
+	if msg := <-ws.sent; !bytes.Contains(msg, []byte(ErrPtzNotManage.Error())) {
+		t.Errorf("should reject ptz without manage rights, got: %s\n", msg)
+	}
+
+	center.onServerCommand(&wsio.FromServerCommand{Name: "ManagePtz", From: 1, Content: []byte(`{"id":"a","op":"fly"}`)})
+	if msg := <-center.ctrlSender; !bytes.Contains(msg, []byte(ErrPtzBadOp.Error())) {
+		t.Errorf("should handle ptz of a manager, got: %s\n", msg)
+	}
+}
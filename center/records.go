@@ -0,0 +1,70 @@
+package center
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/empirefox/ic-client-one/records"
+	"github.com/empirefox/ic-client-one/wsio"
+)
+
+var kRecs = []byte("Records")
+
+// ServeRecords handles /records/:camera/*file, credentials follow Reload.
+func (center *central) ServeRecords(c *gin.Context) {
+	user, password := center.conf.GetRecordsAuth()
+	if user == "" {
+		http.NotFound(c.Writer, c.Request)
+		return
+	}
+	s := &records.FileServer{
+		Dir:      center.conf.GetRecDir(),
+		Index:    center.records,
+		User:     user,
+		Password: password,
+	}
+	s.Serve(c.Writer, c.Request, c.Param("camera"), c.Param("file"))
+}
+
+// updateRecords runs outside the loop like enforceRetention.
+func (center *central) updateRecords() {
+	if !atomic.CompareAndSwapInt32(&center.indexing, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&center.indexing, 0)
+	if err := center.records.Update(center.Connectors.Ids()); err != nil {
+		glog.Errorln("index records failed:", err)
+	}
+}
+
+// Content => records.Query
+func (center *central) onManageListRecords(cmd *wsio.FromServerCommand) {
+	var q records.Query
+	if len(cmd.Content) != 0 {
+		if err := json.Unmarshal(cmd.Content, &q); err != nil {
+			center.ctrlConn.Send(cmd.ToManyInfo("Cannot parse records query"))
+			return
+		}
+	}
+	center.ctrlConn.Send(cmd.ToManyObj(kRecs, center.records.List(q)))
+}
+
+// Content => records.Query
+func (center *central) onLocalListRecords(cmd *FromLocalCommand) {
+	var q records.Query
+	if len(cmd.Content) != 0 {
+		if err := json.Unmarshal(cmd.Content, &q); err != nil {
+			glog.Errorln(err)
+			return
+		}
+	}
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "Records",
+		"content": center.records.List(q),
+	})
+	cmd.Ws.Send(msg)
+}
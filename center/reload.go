@@ -0,0 +1,95 @@
+package center
+
+import (
+	"encoding/json"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const setupPollInterval = 2 * time.Second
+
+// watchSetup triggers a reload on SIGHUP, or when the setup file changes.
+func (center *central) watchSetup() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var poll <-chan time.Time
+	var modTime int64
+	if center.conf.SetupFile() != "" {
+		modTime, _ = center.conf.SetupModTime()
+		ticker := time.NewTicker(setupPollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-hup:
+			glog.Infoln("SIGHUP, reloading setup")
+			center.ReloadSetup()
+		case <-poll:
+			t, err := center.conf.SetupModTime()
+			if err != nil || t == modTime {
+				continue
+			}
+			modTime = t
+			glog.Infoln("setup file changed, reloading")
+			center.ReloadSetup()
+		case <-center.quit:
+			return
+		}
+	}
+}
+
+func (center *central) ReloadSetup() {
+	select {
+	case center.reloadSetup <- struct{}{}:
+	default:
+		// a reload is already pending
+	}
+}
+
+func (center *central) onReloadSetup(ticker *time.Ticker) {
+	ch, err := center.conf.Reload()
+	if err != nil {
+		glog.Errorln("reload setup failed:", err)
+		center.sendSetupReloaded(map[string]interface{}{"Error": err.Error()})
+		return
+	}
+	if ch.Empty() {
+		return
+	}
+
+	if len(ch.IceAdded) != 0 {
+		glog.Infoln("ice servers added:", len(ch.IceAdded))
+		center.addIceServers(ch.IceAdded)
+	}
+	if ch.PingSecond {
+		// connections watch conf.PingChanged themselves
+		glog.Infoln("PingSecond changed to", center.conf.GetPingSecond())
+		ticker.Reset(center.conf.GetPingSecond() / 4)
+	}
+	if ch.WsUrl {
+		glog.Infoln("WsUrl changed, reconnecting ctrl")
+		center.closeCtrl()
+		center.onDelCtrl(center.ctrlConn)
+		center.onConnectCtrl()
+	}
+	for _, field := range ch.Restart {
+		glog.Warningln("setup", field, "changed, restart to apply")
+	}
+	center.sendSetupReloaded(ch)
+}
+
+func (center *central) sendSetupReloaded(content interface{}) {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "SetupReloaded",
+		"content": content,
+	})
+	center.onChangeNoStatus(msg)
+}
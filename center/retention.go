@@ -0,0 +1,49 @@
+package center
+
+import (
+	"encoding/json"
+	"sync/atomic"
+
+	"github.com/golang/glog"
+
+	"github.com/empirefox/ic-client-one/records"
+	"github.com/empirefox/ic-client-one/wsio"
+)
+
+var kRecRm = []byte("RecRemoved")
+
+// enforceRetention runs outside the loop, a slow disk must not block it.
+func (center *central) enforceRetention() {
+	if !atomic.CompareAndSwapInt32(&center.retaining, 0, 1) {
+		glog.Warningln("retention is still running, skipped")
+		return
+	}
+	defer atomic.StoreInt32(&center.retaining, 0)
+
+	policy := center.conf.GetRetentionPolicy()
+	if !policy.Enabled() {
+		return
+	}
+	report, err := records.Enforce(center.conf.GetRecDir(), center.Connectors.Ids(), policy)
+	if err != nil {
+		glog.Errorln("retention failed:", err)
+		return
+	}
+	if len(report.Removed) == 0 && len(report.Errors) == 0 {
+		return
+	}
+	for _, rm := range report.Removed {
+		center.records.Remove(rm.Path)
+	}
+	glog.Infof("retention removed %d recordings, freed %d bytes\n", len(report.Removed), report.Freed)
+	for _, e := range report.Errors {
+		glog.Errorln("retention:", e)
+	}
+
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "RecordsRemoved",
+		"content": report,
+	})
+	center.ChangeNoStatus(msg)
+	center.SendCtrl(wsio.BcObj(kRecRm, report))
+}
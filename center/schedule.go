@@ -0,0 +1,138 @@
+package center
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/empirefox/ic-client-one/connector"
+	"github.com/empirefox/ic-client-one/schedule"
+	"github.com/empirefox/ic-client-one/wsio"
+)
+
+// recheck at least this often, the wall clock may jump
+const maxScheduleWait = time.Hour
+
+var (
+	kScheds = []byte("Schedules")
+)
+
+// loadSchedules applies every schedule that has no known state yet,
+// so recording follows the schedules after a restart.
+func (center *central) loadSchedules() {
+	ss, err := center.store.GetSchedules()
+	if err != nil {
+		glog.Errorln("load schedules failed:", err)
+		return
+	}
+	center.schedules = ss
+	for id := range center.schedState {
+		if s, ok := ss[id]; !ok || s.Disabled {
+			if center.schedState[id] {
+				center.Connectors.SetRecBy(id, connector.RecBySchedule, false)
+			}
+			delete(center.schedState, id)
+		}
+	}
+	center.applySchedules(time.Now())
+}
+
+// applySchedules switches recording when a schedule enters or leaves a window.
+// Only the recorder is switched, the stored Rec of the operator stays.
+func (center *central) applySchedules(now time.Time) {
+	next := now.Add(maxScheduleWait)
+	for id, s := range center.schedules {
+		if s.Disabled {
+			continue
+		}
+		on := s.On(now)
+		if prev, ok := center.schedState[id]; !ok || prev != on {
+			glog.Infoln("schedule sets recording of", id, "to", on)
+			center.Connectors.SetRecBy(id, connector.RecBySchedule, on)
+			center.schedState[id] = on
+		}
+		if t, ok := s.Next(now); ok && t.Before(next) {
+			next = t
+		}
+	}
+	center.schedTimer.Reset(next.Sub(now))
+}
+
+func (center *central) onScheduleTimer() { center.applySchedules(time.Now()) }
+
+func (center *central) onScheduleIdChanged(old, id string) {
+	if on, ok := center.schedState[old]; ok {
+		delete(center.schedState, old)
+		center.schedState[id] = on
+	}
+	center.loadSchedules()
+}
+
+func (center *central) putSchedule(content []byte) error {
+	var s schedule.Schedule
+	if err := json.Unmarshal(content, &s); err != nil {
+		return err
+	}
+	if err := center.store.PutSchedule(&s); err != nil {
+		return err
+	}
+	// apply the new windows now
+	delete(center.schedState, s.Camera)
+	center.loadSchedules()
+	return nil
+}
+
+func (center *central) delSchedule(id []byte) error {
+	if err := center.store.RemoveSchedule(id); err != nil {
+		return err
+	}
+	center.loadSchedules()
+	return nil
+}
+
+func (center *central) onManageGetSchedules(cmd *wsio.FromServerCommand) {
+	center.ctrlConn.Send(cmd.ToManyObj(kScheds, center.schedules))
+}
+
+// Content => schedule.Schedule
+func (center *central) onManageSetSchedule(cmd *wsio.FromServerCommand) {
+	if err := center.putSchedule(cmd.Content); err != nil {
+		center.ctrlConn.Send(cmd.ToManyInfo("Save schedule failed: " + err.Error()))
+		return
+	}
+	center.ctrlConn.Send(cmd.ToManyObj(kScheds, center.schedules))
+}
+
+// Content => Ipcam.Id
+func (center *central) onManageDelSchedule(cmd *wsio.FromServerCommand) {
+	if err := center.delSchedule(cmd.Value()); err != nil {
+		center.ctrlConn.Send(cmd.ToManyInfo("Remove schedule failed: " + err.Error()))
+		return
+	}
+	center.ctrlConn.Send(cmd.ToManyObj(kScheds, center.schedules))
+}
+
+func (center *central) sendLocalSchedules(ws Ws) {
+	msg, _ := json.Marshal(map[string]interface{}{
+		"type":    "Schedules",
+		"content": center.schedules,
+	})
+	ws.Send(msg)
+}
+
+func (center *central) onLocalSetSchedule(cmd *FromLocalCommand) {
+	if err := center.putSchedule(cmd.Content); err != nil {
+		glog.Errorln(err)
+		return
+	}
+	center.sendLocalSchedules(cmd.Ws)
+}
+
+func (center *central) onLocalDelSchedule(cmd *FromLocalCommand) {
+	if err := center.delSchedule(cmd.Value()); err != nil {
+		glog.Errorln(err)
+		return
+	}
+	center.sendLocalSchedules(cmd.Ws)
+}
@@ -0,0 +1,50 @@
+package center
+
+import (
+	"sync"
+
+	"github.com/empirefox/ic-client-one/ipcam"
+	"github.com/empirefox/ic-client-one/rtsp"
+	"github.com/empirefox/ic-client-one/storage"
+)
+
+// needUrlCheck reports whether s adds an ipcam or changes its Url.
+func (center *central) needUrlCheck(s *ipcam.SetterIpcam) bool {
+	if s.SkipUrlCheck || s.Url == "" {
+		return false
+	}
+	id := s.Target
+	if id == "" {
+		id = s.Id
+	}
+	i, err := center.store.GetIpcam([]byte(id))
+	return err != nil || i.Url != s.Url
+}
+
+func checkUrl(url string) error {
+	_, err := rtsp.Probe(url, rtsp.PROBE_TIMEOUT)
+	return err
+}
+
+// checkUrls probes the checked setters at the same time.
+func checkUrls(setters []ipcam.SetterIpcam, check []bool) error {
+	errs := make([]error, len(setters))
+	var wg sync.WaitGroup
+	for k := range setters {
+		if !check[k] {
+			continue
+		}
+		wg.Add(1)
+		go func(k int) {
+			defer wg.Done()
+			errs[k] = checkUrl(setters[k].Url)
+		}(k)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return &storage.BatchError{Errs: errs}
+		}
+	}
+	return nil
+}
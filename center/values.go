@@ -23,4 +23,8 @@ var (
 	BAD_REG_TOKEN        = []byte(`{"type":"Regable","content":"bad_reg_token"}`)
 	SAVE_REG_TOKEN_ERROR = []byte(`{"type":"Regable","content":"save_reg_token_error"}`)
 	REGABLE              = []byte(`{"type":"Regable","content":"regable"}`)
+
+	DISK_OK         = []byte(`{"type":"Disk","content":"disk_ok"}`)
+	DISK_LOW        = []byte(`{"type":"Disk","content":"disk_low"}`)
+	REC_WRITE_ERROR = []byte(`{"type":"Disk","content":"rec_write_error"}`)
 )
@@ -0,0 +1,28 @@
+package connector
+
+import (
+	"math/rand"
+	"time"
+)
+
+// backoff doubles the delay from base after each failure up to max,
+// then moves it by up to jitter of itself, so cameras do not retry in lockstep.
+type backoff struct {
+	attempt int
+}
+
+func (b *backoff) next(base, max time.Duration, jitter float64) time.Duration {
+	d := max
+	if b.attempt < 32 {
+		if n := base << uint(b.attempt); n > 0 && n < max {
+			d = n
+			b.attempt++
+		}
+	}
+	if jitter > 0 {
+		d += time.Duration((rand.Float64()*2 - 1) * jitter * float64(d))
+	}
+	return d
+}
+
+func (b *backoff) reset() { b.attempt = 0 }
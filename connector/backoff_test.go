@@ -0,0 +1,28 @@
+package connector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	var b backoff
+	want := []time.Duration{1, 2, 4, 8, 10, 10}
+	for i, w := range want {
+		if d := b.next(time.Second, 10*time.Second, 0); d != w*time.Second {
+			t.Errorf("attempt %d should wait %v, got: %v\n", i, w*time.Second, d)
+		}
+	}
+	b.reset()
+	if d := b.next(time.Second, 10*time.Second, 0); d != time.Second {
+		t.Errorf("should start from base after reset, got: %v\n", d)
+	}
+
+	b.reset()
+	for i := 0; i < 100; i++ {
+		d := b.next(time.Second, 10*time.Second, 0.5)
+		if d < 500*time.Millisecond || d > 15*time.Second {
+			t.Errorf("jitter out of range: %v\n", d)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/empirefox/ic-client-one-wrap"
 	"github.com/empirefox/ic-client-one/ipcam"
+	"github.com/empirefox/ic-client-one/onvif"
+	"github.com/empirefox/ic-client-one/rtsp"
 	"github.com/empirefox/ic-client-one/storage"
 	"github.com/empirefox/ic-client-one/wsio"
 	"github.com/golang/glog"
@@ -14,37 +16,59 @@ import (
 type Connector struct {
 	cs        *Connectors
 	Conf      *storage.Conf
+	Store     storage.Store
 	Conductor rtc.Conductor
 
-	saveData *SaveData
-	i        ipcam.Ipcam
-	force    bool
-	reging   bool
-	deleted  bool
-	delCmd   *wsio.FromServerCommand
-
-	ChanView   chan *wsio.FromServerCommand
-	ChanSave   chan *SaveData
-	ChanGet    chan *wsio.FromServerCommand
-	ChanDel    chan *wsio.FromServerCommand
-	ChanQuit   chan struct{}
-	chanQuit   chan struct{}
-	chanReg    chan *wsio.FromServerCommand
-	chanEndReg chan regEndData
-	chanUnreg  chan string
-	chanGs     chan gangStatusData
-	chanCopy   chan (chan<- ipcam.Ipcam)
-	chanRec    chan bool
-	chanLbc    chan struct{}
+	saveData  *SaveData
+	i         ipcam.Ipcam
+	force     bool
+	reging    bool
+	regFailed bool
+	deleted   bool
+	delCmd    *wsio.FromServerCommand
+	backoff   backoff
+	retry     *time.Timer
+	// reconnect asked while reging, run after it
+	reconnectCmd *wsio.FromServerCommand
+	probing      bool
+	// saved, probe the device again even if probed lately
+	probeDue bool
+	probe    *time.Timer
+	// RecBy* bits, the recorder runs when Rec or any is set
+	recBy int
+
+	ChanView    chan *wsio.FromServerCommand
+	ChanSave    chan *SaveData
+	ChanGet     chan *wsio.FromServerCommand
+	ChanDel     chan *wsio.FromServerCommand
+	ChanQuit    chan struct{}
+	chanQuit    chan struct{}
+	chanReg     chan *wsio.FromServerCommand
+	chanEndReg  chan regEndData
+	chanUnreg   chan string
+	chanGs      chan gangStatusData
+	chanCopy    chan (chan<- ipcam.Ipcam)
+	chanRec     chan bool
+	chanRecBy   chan recByData
+	chanLbc     chan struct{}
+	chanGroup   chan *groupData
+	chanRetry   chan struct{}
+	chanReconn  chan *wsio.FromServerCommand
+	chanRemoved chan *wsio.FromServerCommand
+	chanProbed  chan probeData
 
 	OnEvent     func(e *Event)
 	OnIdChanged func(e *ChIdEvent)
 }
 
 func (c *Connector) Run() {
-	ticker := time.NewTicker(time.Second * 20)
+	c.retry = time.NewTimer(time.Hour)
+	c.retry.Stop()
+	c.probe = time.NewTimer(time.Hour)
+	c.probe.Stop()
 	defer func() {
-		ticker.Stop()
+		c.retry.Stop()
+		c.probe.Stop()
 	}()
 
 	for {
@@ -57,23 +81,40 @@ func (c *Connector) Run() {
 
 		case rec := <-c.chanRec:
 			c.onRec(rec)
+		case data := <-c.chanRecBy:
+			c.onRecBy(data)
 
 		case <-c.chanLbc:
 			c.onLocalBroadcast()
 
+		case data := <-c.chanGroup:
+			c.onGroup(data)
+
 		case cmd := <-c.ChanGet:
 			c.onGet(cmd)
 
 		case cmd := <-c.ChanDel:
-			c.onDel(cmd)
+			c.onDel(cmd, false)
+		case cmd := <-c.chanRemoved:
+			c.onDel(cmd, true)
 
-		case <-ticker.C:
+		case <-c.retry.C:
+			c.i.RetryAt = 0
 			c.goReging(nil)
+		case <-c.chanRetry:
+			c.onRetryNow()
+		case cmd := <-c.chanReconn:
+			c.onReconnect(cmd)
 		case cmd := <-c.chanReg:
 			c.goReging(cmd)
 		case data := <-c.chanEndReg:
 			c.onRegEnd(data)
 
+		case <-c.probe.C:
+			c.goProbe()
+		case data := <-c.chanProbed:
+			c.onProbed(data)
+
 		case id := <-c.chanUnreg:
 			c.unregistry(id)
 
@@ -108,16 +149,20 @@ func (c *Connector) onLocalBroadcast() {
 	})
 }
 
+func (c *Connector) recording() bool { return c.i.Rec || c.recBy != 0 }
+
 func (c *Connector) onRec(rec bool) {
 	if c.i.Rec != rec {
-		err := c.Conf.SetIpcamAttr([]byte(c.i.Id), ipcam.K_IC_REC, []byte(strconv.FormatBool(rec)))
+		err := c.Store.SetIpcamAttr([]byte(c.i.Id), ipcam.K_IC_REC, []byte(strconv.FormatBool(rec)))
 		if err != nil {
 			// TODO report error?
 			glog.Errorln(err)
 			return
 		}
+		was := c.recording()
 		c.i.Rec = rec
-		c.Conductor.SetRecordEnabled(c.i.Id, rec)
+		c.i.Rev++
+		c.setRecording(was)
 	}
 	c.OnEvent(&Event{
 		Type: RecChanged,
@@ -125,6 +170,40 @@ func (c *Connector) onRec(rec bool) {
 	})
 }
 
+// onRecBy switches the recorder without touching the stored Rec.
+func (c *Connector) onRecBy(data recByData) {
+	was := c.recording()
+	if data.on {
+		c.recBy |= data.by
+	} else {
+		c.recBy &^= data.by
+	}
+	c.setRecording(was)
+}
+
+func (c *Connector) setRecording(was bool) {
+	if rec := c.recording(); rec != was {
+		c.Conductor.SetRecordEnabled(c.i.Id, rec)
+	}
+}
+
+// ignored when not in the group
+func (c *Connector) onGroup(data *groupData) {
+	if !c.i.InGroup(data.group) {
+		return
+	}
+	switch data.op {
+	case groupRec:
+		c.onRec(data.on)
+	case groupOff:
+		setter := ipcam.SetterIpcam{Target: c.i.Id, Ipcam: c.i}
+		setter.ClearRuntime()
+		setter.Groups = append([]string(nil), c.i.Groups...)
+		setter.Off = data.on
+		c.onSave(&SaveData{Cmd: data.cmd, Setter: setter})
+	}
+}
+
 func (c *Connector) goReging(cmd *wsio.FromServerCommand) {
 	if c.delCmd != nil {
 		c.delNotify()
@@ -135,15 +214,22 @@ func (c *Connector) goReging(cmd *wsio.FromServerCommand) {
 	}
 	if !c.reging {
 		c.reging = true
-		go c.registry(c.i, c.force, cmd)
+		go c.registry(c.i, c.recording(), c.force, cmd)
 	}
 }
 
 // run in standalone goroutine, need Ipcam copy
 // TODO use force?
-func (c *Connector) registry(i ipcam.Ipcam, force bool, cmd *wsio.FromServerCommand) {
-	info := c.Conductor.Registry(i.Id, i.Url, c.Conf.GetRecPrefix(i.Id), i.Rec, i.AudioOff)
-	c.chanEndReg <- regEndData{cmd: cmd, i: i, info: info}
+func (c *Connector) registry(i ipcam.Ipcam, rec, force bool, cmd *wsio.FromServerCommand) {
+	info := c.Conductor.Registry(i.Id, i.Url, c.Conf.GetRecPrefix(i.Id), rec, i.AudioOff)
+	var reason string
+	if !info.Ok {
+		_, err := rtsp.Probe(i.Url, rtsp.PROBE_TIMEOUT)
+		if reason = rtsp.Reason(err); reason == "" {
+			reason = REASON_REG_FAILED
+		}
+	}
+	c.chanEndReg <- regEndData{cmd: cmd, i: i, info: info, reason: reason}
 }
 
 func (c *Connector) onRegEnd(data regEndData) {
@@ -156,44 +242,118 @@ func (c *Connector) onRegEnd(data regEndData) {
 	if c.saveData != nil {
 		c.unregistry(c.saveData.Setter.Target)
 		c.i = c.saveData.Setter.Ipcam
+		c.i.ClearRuntime()
 		c.saveData = nil
+		c.probeDue = true
 		c.goReging(data.cmd)
 		return
 	}
+	if c.reconnectCmd != nil {
+		cmd := c.reconnectCmd
+		c.reconnectCmd = nil
+		c.reconnect(cmd)
+		return
+	}
+	forced := c.force
+	c.force = false
+	c.recordRegResult(data.info.Ok)
+	if data.info.Ok {
+		c.resetRetry()
+		defer c.goProbe()
+	} else {
+		c.scheduleRetry()
+	}
 
+	ptz := data.info.Ok && c.i.HasFeature(onvif.FEATURE_PTZ)
 	sameStatus := c.i.Online == data.info.Ok &&
 		c.i.HasAudio == data.info.Audio && c.i.HasVideo == data.info.Video &&
-		c.i.Width == data.info.Width && c.i.Height == data.info.Height
+		c.i.Width == data.info.Width && c.i.Height == data.info.Height &&
+		c.i.Ptz == ptz && c.i.OfflineReason == data.reason
 	if sameStatus {
+		msg := "Not changed: " + c.i.Id
+		if forced {
+			msg = reconnectResult(data.info.Ok, c.i.Id)
+		}
 		c.OnEvent(&Event{
 			Type: StatusNoChange,
 			Cmd:  data.cmd,
 			Ic:   c.i,
-			Msg:  "Not changed: " + c.i.Id,
+			Msg:  msg,
 		})
 		return
 	}
 
+	prev := c.i
 	c.i.Online = data.info.Ok
 	c.i.HasAudio, c.i.HasVideo = data.info.Audio, data.info.Video
 	c.i.Width, c.i.Height = data.info.Width, data.info.Height
-	if err := c.Conf.PutIpcam(&c.i); err != nil {
+	c.i.Ptz = ptz
+	c.i.OfflineReason = data.reason
+	c.recordHistory(&prev)
+	if err := c.Store.PutIpcamStatus(&c.i); err != nil {
 		// TODO report error?
 		glog.Errorln(err)
 	}
+	msg := "Changes saved: " + c.i.Id
+	if forced {
+		msg = reconnectResult(data.info.Ok, c.i.Id)
+	}
 	c.OnEvent(&Event{
 		Type: StatusChanged,
 		Cmd:  data.cmd,
 		Ic:   c.i,
-		Msg:  "Changes saved: " + c.i.Id,
+		Msg:  msg,
 	})
 }
 
+func reconnectResult(ok bool, id string) string {
+	if ok {
+		return "Reconnected: " + id
+	}
+	return "Reconnect failed: " + id
+}
+
+// onReconnect registers again even when Online, replies progress to cmd.
+func (c *Connector) onReconnect(cmd *wsio.FromServerCommand) {
+	if c.i.Off {
+		c.OnEvent(&Event{
+			Type: StatusNoChange,
+			Cmd:  cmd,
+			Ic:   c.i,
+			Msg:  "Ipcam is off: " + c.i.Id,
+		})
+		return
+	}
+	c.OnEvent(&Event{
+		Type: StatusNoChange,
+		Cmd:  cmd,
+		Ic:   c.i,
+		Msg:  "Reconnecting: " + c.i.Id,
+	})
+	if c.reging {
+		c.reconnectCmd = cmd
+		return
+	}
+	c.reconnect(cmd)
+}
+
+func (c *Connector) reconnect(cmd *wsio.FromServerCommand) {
+	c.force = true
+	c.unregistry(c.i.Id)
+	c.resetRetry()
+	c.goReging(cmd)
+}
+
 func (c *Connector) onSave(data *SaveData) {
 	sameDevice := c.i.Id == data.Setter.Ipcam.Id && c.i.Url == data.Setter.Ipcam.Url &&
-		c.i.AudioOff == data.Setter.Ipcam.AudioOff && c.i.Off == data.Setter.Ipcam.Off
+		c.i.Onvif == data.Setter.Ipcam.Onvif &&
+		c.i.AudioOff == data.Setter.Ipcam.AudioOff && c.i.Off == data.Setter.Ipcam.Off &&
+		c.i.SameGroups(&data.Setter.Ipcam)
 
 	if sameDevice {
+		if data.Stored {
+			c.i.Rev, c.i.UpdatedAt = data.Setter.Rev, data.Setter.UpdatedAt
+		}
 		c.OnEvent(&Event{
 			Type: StatusNoChange,
 			Cmd:  data.Cmd,
@@ -203,7 +363,21 @@ func (c *Connector) onSave(data *SaveData) {
 		return
 	}
 
-	if err := c.Conf.PutIpcam(&data.Setter.Ipcam, []byte(data.Setter.Target)); err != nil {
+	if data.Setter.Url == c.i.Url && data.Setter.Onvif == c.i.Onvif && data.Setter.ProbedAt == 0 {
+		data.Setter.CopyDevice(&c.i)
+	}
+	if data.Stored {
+		// saved by the batch
+	} else if err := c.Store.PutIpcam(&data.Setter.Ipcam, []byte(data.Setter.Target)); err != nil {
+		if err == storage.ErrIpcamConflict {
+			c.OnEvent(&Event{
+				Type: SaveConflict,
+				Cmd:  data.Cmd,
+				Ic:   c.i,
+				Msg:  "Changed by others, reload and retry: " + c.i.Id,
+			})
+			return
+		}
 		glog.Errorln(err)
 		c.OnEvent(&Event{
 			Type: SaveFailed,
@@ -225,6 +399,10 @@ func (c *Connector) onSave(data *SaveData) {
 
 	c.unregistry(data.Setter.Target)
 	c.i = data.Setter.Ipcam
+	// not registered any more, whatever the setter carried
+	c.i.ClearRuntime()
+	c.probeDue = true
+	c.resetRetry()
 	c.goReging(data.Cmd)
 }
 
@@ -237,8 +415,11 @@ func (c *Connector) onGet(cmd *wsio.FromServerCommand) {
 	})
 }
 
-func (c *Connector) onDel(cmd *wsio.FromServerCommand) {
-	if err := c.Conf.RemoveIpcam([]byte(c.i.Id)); err != nil {
+// removed means a batch has removed it from the store
+func (c *Connector) onDel(cmd *wsio.FromServerCommand, removed bool) {
+	if removed {
+		// nothing to remove
+	} else if err := c.Store.RemoveIpcam([]byte(c.i.Id)); err != nil {
 		c.OnEvent(&Event{
 			Type: DelFailed,
 			Cmd:  cmd,
@@ -281,7 +462,15 @@ func (c *Connector) onGangStatus(data gangStatusData) {
 	if c.i.Online == data.ok {
 		return
 	}
+	prev := c.i
 	c.i.Online = data.ok
+	if data.ok {
+		c.i.OfflineReason = ""
+	}
+	c.recordHistory(&prev)
+	if !data.ok {
+		c.scheduleRetry()
+	}
 	c.OnEvent(&Event{
 		Type: StatusChanged,
 		Cmd:  new(wsio.FromServerCommand),
@@ -289,4 +478,108 @@ func (c *Connector) onGangStatus(data gangStatusData) {
 	})
 }
 
+// scheduleRetry waits longer after each failure, see backoff.
+func (c *Connector) scheduleRetry() {
+	if c.i.Off {
+		return
+	}
+	c.i.RegFailures++
+	d := c.backoff.next(c.Conf.GetRetryBackoff())
+	c.i.RetryAt = time.Now().Add(d).Unix()
+	c.retry.Reset(d)
+}
+
+func (c *Connector) resetRetry() {
+	c.backoff.reset()
+	c.retry.Stop()
+	c.i.RegFailures, c.i.RetryAt = 0, 0
+}
+
+// onRetryNow skips the current wait, the next failure starts from base.
+func (c *Connector) retryNow() {
+	select {
+	case c.chanRetry <- struct{}{}:
+	default:
+		// one is pending
+	}
+}
+
+func (c *Connector) onRetryNow() {
+	c.backoff.reset()
+	c.retry.Stop()
+	c.i.RetryAt = 0
+	c.goReging(nil)
+}
+
+// goProbe asks an online device about itself when saved or not probed in
+// DEVICE_PROBE_INTERVAL, otherwise waits for the interval.
+func (c *Connector) goProbe() {
+	if c.probing || !c.i.Online || c.delCmd != nil {
+		return
+	}
+	if !c.probeDue {
+		if d := time.Unix(c.i.ProbedAt, 0).Add(DEVICE_PROBE_INTERVAL).Sub(time.Now()); d > 0 {
+			c.probe.Reset(d)
+			return
+		}
+	}
+	c.probing = true
+	c.probeDue = false
+	go c.probeDevice(c.i.Onvif, c.i.Url)
+}
+
+// run in standalone goroutine
+func (c *Connector) probeDevice(xaddr, url string) {
+	info, err := onvif.Probe(xaddr, url)
+	c.chanProbed <- probeData{onvif: xaddr, url: url, info: info, err: err}
+}
+
+func (c *Connector) onProbed(data probeData) {
+	c.probing = false
+	if data.url != c.i.Url || data.onvif != c.i.Onvif {
+		// saved while probing
+		c.goProbe()
+		return
+	}
+	c.probe.Reset(DEVICE_PROBE_INTERVAL)
+	if data.err != nil {
+		glog.Warningln("probe ipcam", c.i.Id, "failed:", data.err)
+		return
+	}
+	c.i.Vendor, c.i.Model = data.info.Manufacturer, data.info.Model
+	c.i.Firmware, c.i.Serial = data.info.FirmwareVersion, data.info.SerialNumber
+	c.i.Features = data.info.Features
+	c.i.ProbedAt = time.Now().Unix()
+	c.i.Ptz = c.i.Online && c.i.HasFeature(onvif.FEATURE_PTZ)
+	if err := c.Store.PutIpcamStatus(&c.i); err != nil {
+		glog.Errorln(err)
+	}
+	c.OnEvent(&Event{
+		Type: StatusChanged,
+		Cmd:  new(wsio.FromServerCommand),
+		Ic:   c.i,
+		Msg:  "Device probed: " + c.i.Id,
+	})
+}
+
 func (c *Connector) onCopyOf(ch chan<- ipcam.Ipcam) { ch <- c.i }
+
+func (c *Connector) recordHistory(prev *ipcam.Ipcam) {
+	hs := c.i.Transitions(prev, time.Now().Unix())
+	if err := c.Store.AppendIpcamHistory(c.i.Id, hs...); err != nil {
+		glog.Errorln(err)
+	}
+}
+
+// only the first failure of a row is recorded
+func (c *Connector) recordRegResult(ok bool) {
+	if ok || c.regFailed {
+		c.regFailed = !ok
+		return
+	}
+	c.regFailed = true
+	h := ipcam.History{At: time.Now().Unix(), Type: ipcam.HISTORY_REG_FAILED}
+	if err := c.Store.AppendIpcamHistory(c.i.Id, h); err != nil {
+		glog.Errorln(err)
+	}
+}
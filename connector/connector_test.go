@@ -0,0 +1,101 @@
+package connector
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/empirefox/ic-client-one-wrap"
+	"github.com/empirefox/ic-client-one/ipcam"
+	"github.com/empirefox/ic-client-one/storage"
+	"github.com/empirefox/ic-client-one/wsio"
+)
+
+type fakeConductor struct {
+	mu         sync.Mutex
+	registered map[string]bool
+}
+
+func (fc *fakeConductor) Registry(id, url, recName string, rec, audioOff bool) rtc.IpcamAvInfo {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	fc.registered[id] = true
+	return rtc.IpcamAvInfo{Ok: true, Video: true}
+}
+
+func (fc *fakeConductor) UnRegistry(id string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	delete(fc.registered, id)
+}
+
+func (fc *fakeConductor) isRegistered(id string) bool {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.registered[id]
+}
+
+func (fc *fakeConductor) Release()                                             {}
+func (fc *fakeConductor) SetRecordEnabled(id string, rec bool)                 {}
+func (fc *fakeConductor) CreatePeer(id string, send func([]byte)) rtc.PeerConn { return nil }
+func (fc *fakeConductor) DeletePeer(pc rtc.PeerConn)                           {}
+func (fc *fakeConductor) AddIceServer(uri, name, psd string)                   {}
+
+const testSetup = `{
+	"DbPath": ":memory:",
+	"RecDir": "/tmp/ic-client-one-rec-dir",
+	"WsUrl": "ws://127.0.0.1:9998",
+	"PingSecond": 50
+}`
+
+func waitFor(t *testing.T, what string, ok func() bool) {
+	for deadline := time.Now().Add(2 * time.Second); !ok(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s\n", what)
+		}
+	}
+}
+
+func TestConnectors_GroupOffOn(t *testing.T) {
+	conf, err := storage.NewConf(testSetup)
+	if err != nil {
+		t.Fatalf("NewConf failed, err: %v\n", err)
+	}
+	store := storage.NewMemStore(0)
+	// refused port, the device probe fails fast
+	store.PutIpcam(&ipcam.Ipcam{Id: "a", Url: "rtsp://127.0.0.1:1/a", Groups: []string{"g"}})
+
+	fc := &fakeConductor{registered: make(map[string]bool)}
+	quit := make(chan struct{})
+	defer close(quit)
+	f := &ConnectorFactory{
+		Conf:        conf,
+		Store:       store,
+		Conductor:   fc,
+		ChanQuit:    quit,
+		OnEvent:     func(e *Event) {},
+		OnIdChanged: func(e *ChIdEvent) {},
+	}
+	cs := f.NewConnectors()
+	cs.Start()
+	online := func() bool {
+		ch := make(chan ipcam.Ipcam, 1)
+		cs.CopyOf("a", ch)
+		i := <-ch
+		return i.Online
+	}
+	waitFor(t, "registration", func() bool { return fc.isRegistered("a") && online() })
+
+	cmd := new(wsio.FromServerCommand)
+	cs.SetGroupOff(cmd, "g", true)
+	waitFor(t, "group off", func() bool {
+		i, _ := store.GetIpcam([]byte("a"))
+		return i.Off && !fc.isRegistered("a")
+	})
+	if online() {
+		t.Errorf("should not be online when off\n")
+	}
+
+	cs.SetGroupOff(cmd, "g", false)
+	waitFor(t, "registration after group on", func() bool { return fc.isRegistered("a") && online() })
+}
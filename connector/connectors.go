@@ -48,6 +48,65 @@ func (cs *Connectors) SetRec(id string, rec bool) {
 	}
 }
 
+// SetRecBy switches the recorder of id for a reason other than the
+// operator, see RecBy*. Nothing is saved, a restart forgets it.
+func (cs *Connectors) SetRecBy(id string, by int, on bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if c, ok := cs.s[id]; ok {
+		c.chanRecBy <- recByData{by: by, on: on}
+	}
+}
+
+// RetryNow registers id again without waiting its backoff, every offline
+// ipcam when id is empty. Returns false when id is not found.
+func (cs *Connectors) RetryNow(id string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if id != "" {
+		c, ok := cs.s[id]
+		if ok {
+			c.retryNow()
+		}
+		return ok
+	}
+	for _, c := range cs.s {
+		c.retryNow()
+	}
+	return true
+}
+
+// SetGroupRec switches recording of every ipcam in group.
+func (cs *Connectors) SetGroupRec(group string, rec bool) {
+	cs.group(&groupData{group: group, op: groupRec, on: rec})
+}
+
+// SetGroupOff saves Off of every ipcam in group, each replies to cmd.
+func (cs *Connectors) SetGroupOff(cmd *wsio.FromServerCommand, group string, off bool) {
+	cs.group(&groupData{cmd: cmd, group: group, op: groupOff, on: off})
+}
+
+// group sends without the lock, a connector may be waiting for the center
+// that is calling this.
+func (cs *Connectors) group(data *groupData) {
+	for _, c := range cs.all() {
+		select {
+		case c.chanGroup <- data:
+		case <-c.chanQuit:
+		}
+	}
+}
+
+func (cs *Connectors) all() []*Connector {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	all := make([]*Connector, 0, len(cs.s))
+	for _, c := range cs.s {
+		all = append(all, c)
+	}
+	return all
+}
+
 func (cs *Connectors) Ids() (ids []string) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
@@ -60,16 +119,29 @@ func (cs *Connectors) Ids() (ids []string) {
 func (cs *Connectors) Save(cmd *wsio.FromServerCommand, setter ipcam.SetterIpcam) {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
+	cs.save(&SaveData{Cmd: cmd, Setter: setter})
+}
+
+// SaveStored applies setters already saved by Store.SaveIpcams.
+func (cs *Connectors) SaveStored(cmd *wsio.FromServerCommand, setters []ipcam.SetterIpcam) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, setter := range setters {
+		cs.save(&SaveData{Cmd: cmd, Setter: setter, Stored: true})
+	}
+}
 
+func (cs *Connectors) save(data *SaveData) {
+	setter := data.Setter
 	if c, ok := cs.s[setter.Target]; ok {
-		c.ChanSave <- &SaveData{Cmd: cmd, Setter: setter}
+		c.ChanSave <- data
 	} else {
 		// TODO send id list
 		setter.Target = ""
 		c = cs.f.NewConnector(cs, setter.Ipcam)
 		cs.s[c.i.Id] = c
 		go c.Run()
-		c.chanReg <- cmd
+		c.chanReg <- data.Cmd
 	}
 }
 func (cs *Connectors) onSaved(id string, c *Connector) {
@@ -89,34 +161,26 @@ func (cs *Connectors) CopyOf(id string, ch chan<- ipcam.Ipcam) {
 	}
 }
 
-func (cs *Connectors) Get(cmd *wsio.FromServerCommand, id string) {
+// Get returns false when id is not found, the caller replies then.
+func (cs *Connectors) Get(cmd *wsio.FromServerCommand, id string) bool {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
-	if c, ok := cs.s[id]; ok {
+	c, ok := cs.s[id]
+	if ok {
 		c.ChanGet <- cmd
-	} else {
-		cs.f.OnEvent(&Event{
-			Type: IcNotFound,
-			Cmd:  cmd,
-			Ic:   ipcam.Ipcam{Id: id},
-			Msg:  "Ipcam not found: " + c.i.Id,
-		})
 	}
+	return ok
 }
 
-func (cs *Connectors) Del(cmd *wsio.FromServerCommand, id string) {
+// Del returns false when id is not found, the caller replies then.
+func (cs *Connectors) Del(cmd *wsio.FromServerCommand, id string) bool {
 	cs.mu.Lock()
 	defer cs.mu.Unlock()
-	if c, ok := cs.s[id]; ok {
+	c, ok := cs.s[id]
+	if ok {
 		c.ChanDel <- cmd
-	} else {
-		cs.f.OnEvent(&Event{
-			Type: IcNotFound,
-			Cmd:  cmd,
-			Ic:   ipcam.Ipcam{Id: id},
-			Msg:  "Ipcam not found: " + c.i.Id,
-		})
 	}
+	return ok
 }
 func (cs *Connectors) onDeleted(id string) {
 	cs.mu.Lock()
@@ -124,6 +188,45 @@ func (cs *Connectors) onDeleted(id string) {
 	delete(cs.s, id)
 }
 
+// Reconnect registers id again, every ipcam when id is empty.
+// Returns false when id is not found, the caller replies then.
+func (cs *Connectors) Reconnect(cmd *wsio.FromServerCommand, id string) bool {
+	if id == "" {
+		for _, c := range cs.all() {
+			select {
+			case c.chanReconn <- cmd:
+			case <-c.chanQuit:
+			}
+		}
+		return true
+	}
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	c, ok := cs.s[id]
+	if ok {
+		c.chanReconn <- cmd
+	}
+	return ok
+}
+
+// RemovedStored stops the connectors of ids removed by Store.RemoveIpcams.
+func (cs *Connectors) RemovedStored(cmd *wsio.FromServerCommand, ids []string) {
+	cs.mu.Lock()
+	var removed []*Connector
+	for _, id := range ids {
+		if c, ok := cs.s[id]; ok {
+			removed = append(removed, c)
+		}
+	}
+	cs.mu.Unlock()
+	for _, c := range removed {
+		select {
+		case c.chanRemoved <- cmd:
+		case <-c.chanQuit:
+		}
+	}
+}
+
 // implement rtc.StatusObserver
 func (cs *Connectors) OnGangStatus(id string, status uint) {
 	cs.mu.Lock()
@@ -131,7 +234,7 @@ func (cs *Connectors) OnGangStatus(id string, status uint) {
 
 	c, exist := cs.s[id]
 	if !exist {
-		c.chanUnreg <- id
+		// removed or renamed, nothing to update
 		return
 	}
 
@@ -148,6 +251,7 @@ func (cs *Connectors) OnGangStatus(id string, status uint) {
 
 type ConnectorFactory struct {
 	Conf        *storage.Conf
+	Store       storage.Store
 	Conductor   rtc.Conductor
 	ChanQuit    chan struct{}
 	OnEvent     func(e *Event)
@@ -159,29 +263,36 @@ func (f *ConnectorFactory) NewConnector(cs *Connectors, i ipcam.Ipcam) *Connecto
 		cs:          cs,
 		i:           i,
 		Conf:        f.Conf,
+		Store:       f.Store,
 		Conductor:   f.Conductor,
 		ChanQuit:    f.ChanQuit,
 		OnEvent:     f.OnEvent,
 		OnIdChanged: f.OnIdChanged,
 
-		ChanView:   make(chan *wsio.FromServerCommand, 1),
-		ChanSave:   make(chan *SaveData, 1),
-		ChanGet:    make(chan *wsio.FromServerCommand, 1),
-		ChanDel:    make(chan *wsio.FromServerCommand, 1),
-		chanQuit:   make(chan struct{}, 1),
-		chanReg:    make(chan *wsio.FromServerCommand, 1),
-		chanEndReg: make(chan regEndData, 1),
-		chanGs:     make(chan gangStatusData, 1),
-		chanCopy:   make(chan (chan<- ipcam.Ipcam), 1),
-		chanRec:    make(chan bool, 1),
-		chanLbc:    make(chan struct{}, 1),
+		ChanView:    make(chan *wsio.FromServerCommand, 1),
+		ChanSave:    make(chan *SaveData, 1),
+		ChanGet:     make(chan *wsio.FromServerCommand, 1),
+		ChanDel:     make(chan *wsio.FromServerCommand, 1),
+		chanQuit:    make(chan struct{}, 1),
+		chanReg:     make(chan *wsio.FromServerCommand, 1),
+		chanEndReg:  make(chan regEndData, 1),
+		chanGs:      make(chan gangStatusData, 1),
+		chanCopy:    make(chan (chan<- ipcam.Ipcam), 1),
+		chanRec:     make(chan bool, 1),
+		chanRecBy:   make(chan recByData, 1),
+		chanLbc:     make(chan struct{}, 1),
+		chanGroup:   make(chan *groupData, 1),
+		chanRetry:   make(chan struct{}, 1),
+		chanReconn:  make(chan *wsio.FromServerCommand, 1),
+		chanRemoved: make(chan *wsio.FromServerCommand, 1),
+		chanProbed:  make(chan probeData, 1),
 	}
 }
 
 func (f *ConnectorFactory) NewConnectors() *Connectors {
 	cs := &Connectors{f: f}
 	s := make(map[string]*Connector)
-	for id, i := range f.Conf.GetIpcams() {
+	for id, i := range f.Store.GetIpcams() {
 		s[id] = f.NewConnector(cs, i)
 	}
 	cs.s = s
@@ -1,20 +1,29 @@
 package connector
 
 import (
+	"time"
+
 	"github.com/empirefox/ic-client-one-wrap"
 	"github.com/empirefox/ic-client-one/ipcam"
+	"github.com/empirefox/ic-client-one/onvif"
 	"github.com/empirefox/ic-client-one/wsio"
 )
 
+// a device is asked about itself when saved and once in this interval
+const DEVICE_PROBE_INTERVAL = 24 * time.Hour
+
+// the stream answers rtsp well, but the registration failed anyway
+const REASON_REG_FAILED = "RegFailed"
+
 const (
 	StatusChanged = iota
 	StatusNoChange
 	SaveFailed
 	GetOk
-	IcNotFound
 	DelOk
 	DelFailed
 	RecChanged
+	SaveConflict
 )
 
 type Event struct {
@@ -32,14 +41,48 @@ type ChIdEvent struct {
 type SaveData struct {
 	Cmd    *wsio.FromServerCommand
 	Setter ipcam.SetterIpcam
+	// already saved by a batch
+	Stored bool
 }
 
 type regEndData struct {
 	cmd  *wsio.FromServerCommand
 	i    ipcam.Ipcam
 	info rtc.IpcamAvInfo
+	// why it failed, empty when ok
+	reason string
+}
+
+type probeData struct {
+	onvif string
+	url   string
+	info  *onvif.DeviceInfo
+	err   error
 }
 
 type gangStatusData struct {
 	ok bool
 }
+
+const (
+	groupRec = iota
+	groupOff
+)
+
+// why an ipcam records besides its stored Rec, never saved
+const (
+	RecBySchedule = 1 << iota
+	RecByEvent
+)
+
+type recByData struct {
+	by int
+	on bool
+}
+
+type groupData struct {
+	cmd   *wsio.FromServerCommand
+	group string
+	op    int
+	on    bool
+}
@@ -0,0 +1,23 @@
+package ipcam
+
+import "testing"
+
+func TestIpcams_Groups(t *testing.T) {
+	is := Ipcams{
+		"b": Ipcam{Id: "b", Groups: []string{"indoor"}},
+		"a": Ipcam{Id: "a", Groups: []string{"indoor", "outdoor"}},
+		"c": Ipcam{Id: "c"},
+	}
+	gs := is.Groups()
+	if len(gs) != 2 || len(gs["indoor"]) != 2 || gs["indoor"][0] != "a" || len(gs["outdoor"]) != 1 {
+		t.Errorf("should group sorted ids, got: %v\n", gs)
+	}
+
+	a, b := is["a"], is["b"]
+	if !a.InGroup("outdoor") || b.InGroup("outdoor") {
+		t.Errorf("InGroup failed\n")
+	}
+	if a.SameGroups(&b) || !a.SameGroups(&Ipcam{Groups: []string{"outdoor", "indoor"}}) {
+		t.Errorf("SameGroups should ignore order only\n")
+	}
+}
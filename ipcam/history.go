@@ -0,0 +1,60 @@
+package ipcam
+
+const (
+	HISTORY_ONLINE     = "online"
+	HISTORY_OFFLINE    = "offline"
+	HISTORY_RESOLUTION = "resolution"
+	HISTORY_VIDEO      = "video"
+	HISTORY_AUDIO      = "audio"
+	HISTORY_REG_FAILED = "reg_failed"
+)
+
+// History is one status transition of an ipcam.
+// The status fields are the state after the transition.
+type History struct {
+	At       int64  `json:"at"`
+	Type     string `json:"type"`
+	Online   bool   `json:"online,omitempty"`
+	HasVideo bool   `json:"hasVideo,omitempty"`
+	HasAudio bool   `json:"hasAudio,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+}
+
+// Transitions compares two states of the same ipcam, and returns the
+// history entries from prev to i, stamped with at.
+func (i *Ipcam) Transitions(prev *Ipcam, at int64) []History {
+	var hs []History
+	add := func(t string) {
+		hs = append(hs, History{
+			At:       at,
+			Type:     t,
+			Online:   i.Online,
+			HasVideo: i.HasVideo,
+			HasAudio: i.HasAudio,
+			Width:    i.Width,
+			Height:   i.Height,
+		})
+	}
+	if i.Online != prev.Online {
+		if i.Online {
+			add(HISTORY_ONLINE)
+		} else {
+			add(HISTORY_OFFLINE)
+		}
+	}
+	// only meaningful while online
+	if !i.Online {
+		return hs
+	}
+	if i.Width != prev.Width || i.Height != prev.Height {
+		add(HISTORY_RESOLUTION)
+	}
+	if i.HasVideo != prev.HasVideo {
+		add(HISTORY_VIDEO)
+	}
+	if i.HasAudio != prev.HasAudio {
+		add(HISTORY_AUDIO)
+	}
+	return hs
+}
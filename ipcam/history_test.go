@@ -0,0 +1,25 @@
+package ipcam
+
+import "testing"
+
+func TestIpcam_Transitions(t *testing.T) {
+	prev := Ipcam{}
+	i := Ipcam{Online: true, HasVideo: true, Width: 640, Height: 480}
+	hs := i.Transitions(&prev, 10)
+	if len(hs) != 3 || hs[0].Type != HISTORY_ONLINE || hs[1].Type != HISTORY_RESOLUTION || hs[2].Type != HISTORY_VIDEO {
+		t.Errorf("should get online, resolution and video transitions, got: %v\n", hs)
+	}
+	if hs[0].At != 10 || hs[0].Width != 640 {
+		t.Errorf("should stamp new state\n")
+	}
+
+	off := Ipcam{Online: false, Width: 640, Height: 480}
+	hs = off.Transitions(&i, 20)
+	if len(hs) != 1 || hs[0].Type != HISTORY_OFFLINE {
+		t.Errorf("should only get offline transition, got: %v\n", hs)
+	}
+
+	if hs = i.Transitions(&i, 30); len(hs) != 0 {
+		t.Errorf("should get nothing without change, got: %v\n", hs)
+	}
+}
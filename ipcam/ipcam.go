@@ -2,6 +2,8 @@
 package ipcam
 
 import (
+	"encoding/json"
+	"sort"
 	"strconv"
 
 	"github.com/boltdb/bolt"
@@ -23,6 +25,15 @@ var (
 	K_IC_WIDTH     = []byte("Width")
 	K_IC_HEIGHT    = []byte("Height")
 	K_IC_UPDATE_AT = []byte("UpdatedAt")
+	K_IC_REV       = []byte("Rev")
+	K_IC_GROUPS    = []byte("Groups")
+	K_IC_ONVIF     = []byte("Onvif")
+	K_IC_VENDOR    = []byte("Vendor")
+	K_IC_MODEL     = []byte("Model")
+	K_IC_FIRMWARE  = []byte("Firmware")
+	K_IC_SERIAL    = []byte("Serial")
+	K_IC_FEATURES  = []byte("Features")
+	K_IC_PROBED_AT = []byte("ProbedAt")
 )
 
 type Ipcams map[string]Ipcam
@@ -48,6 +59,29 @@ type Ipcam struct {
 	Width     int    `json:",omitempty" structs:",omitempty" view:",omitempty"`
 	Height    int    `json:",omitempty" structs:",omitempty" view:",omitempty"`
 	UpdatedAt int64  `json:",omitempty" structs:",omitempty" view:",omitempty"`
+	// bumped by every save, editors send back the one they saw
+	Rev int64 `json:",omitempty" structs:",omitempty" view:"-"`
+	// group/tag names, stored as json array
+	Groups []string `json:",omitempty" structs:",omitempty" view:",omitempty"`
+	// ONVIF device service address, a discovered XAddr. Empty guesses it
+	// from Url, see onvif.ClientFromUrl
+	Onvif string `json:",omitempty" structs:",omitempty" view:"-"`
+
+	// probed from the device, Features stored as json array
+	Vendor   string   `json:",omitempty" structs:",omitempty" view:"-"`
+	Model    string   `json:",omitempty" structs:",omitempty" view:"-"`
+	Firmware string   `json:",omitempty" structs:",omitempty" view:"-"`
+	Serial   string   `json:",omitempty" structs:",omitempty" view:"-"`
+	Features []string `json:",omitempty" structs:",omitempty" view:"-"`
+	ProbedAt int64    `json:",omitempty" structs:",omitempty" view:"-"`
+
+	// runtime only, why the last registration failed, see rtsp.Reason
+	OfflineReason string `json:",omitempty" structs:",omitempty" view:"-"`
+	// runtime only, the camera answers ONVIF PTZ commands
+	Ptz bool `json:",omitempty" structs:",omitempty" view:",omitempty"`
+	// runtime only, registrations failed in a row and when to retry
+	RegFailures int   `json:",omitempty" structs:",omitempty" view:"-"`
+	RetryAt     int64 `json:",omitempty" structs:",omitempty" view:"-"`
 }
 
 func (i *Ipcam) FromBucket(id []byte, b *bolt.Bucket) {
@@ -61,6 +95,76 @@ func (i *Ipcam) FromBucket(id []byte, b *bolt.Bucket) {
 	i.Width, _ = strconv.Atoi(string(b.Get(K_IC_WIDTH)))
 	i.Height, _ = strconv.Atoi(string(b.Get(K_IC_HEIGHT)))
 	i.UpdatedAt, _ = strconv.ParseInt(string(b.Get(K_IC_UPDATE_AT)), 10, 64)
+	i.Rev, _ = strconv.ParseInt(string(b.Get(K_IC_REV)), 10, 64)
+	if v := b.Get(K_IC_GROUPS); len(v) != 0 {
+		json.Unmarshal(v, &i.Groups)
+	}
+	i.Onvif = string(b.Get(K_IC_ONVIF))
+	i.Vendor = string(b.Get(K_IC_VENDOR))
+	i.Model = string(b.Get(K_IC_MODEL))
+	i.Firmware = string(b.Get(K_IC_FIRMWARE))
+	i.Serial = string(b.Get(K_IC_SERIAL))
+	if v := b.Get(K_IC_FEATURES); len(v) != 0 {
+		json.Unmarshal(v, &i.Features)
+	}
+	i.ProbedAt, _ = strconv.ParseInt(string(b.Get(K_IC_PROBED_AT)), 10, 64)
+}
+
+func (i *Ipcam) HasFeature(feature string) bool {
+	for _, f := range i.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// ClearRuntime zeroes the fields known only while registered.
+func (i *Ipcam) ClearRuntime() {
+	i.Online, i.Ptz, i.OfflineReason = false, false, ""
+	i.RegFailures, i.RetryAt = 0, 0
+}
+
+// CopyDevice copies the probed fields of o.
+func (i *Ipcam) CopyDevice(o *Ipcam) {
+	i.Vendor, i.Model, i.Firmware, i.Serial = o.Vendor, o.Model, o.Firmware, o.Serial
+	i.Features = append([]string(nil), o.Features...)
+	i.ProbedAt = o.ProbedAt
+}
+
+func (i *Ipcam) InGroup(group string) bool {
+	for _, g := range i.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Ipcam) SameGroups(o *Ipcam) bool {
+	if len(i.Groups) != len(o.Groups) {
+		return false
+	}
+	for _, g := range i.Groups {
+		if !o.InGroup(g) {
+			return false
+		}
+	}
+	return true
+}
+
+// Groups returns the sorted ipcam ids of every group.
+func (is Ipcams) Groups() map[string][]string {
+	gs := make(map[string][]string)
+	for id, i := range is {
+		for _, g := range i.Groups {
+			gs[g] = append(gs[g], id)
+		}
+	}
+	for _, ids := range gs {
+		sort.Strings(ids)
+	}
+	return gs
 }
 
 func (i *Ipcam) Map(tag ...string) map[string]interface{} {
@@ -74,7 +178,10 @@ func (i *Ipcam) Map(tag ...string) map[string]interface{} {
 }
 
 // only unmarshal
+// Ipcam.Rev is the revision the editor saw, 0 to overwrite unconditionally
+// A new Url is probed before saved unless SkipUrlCheck.
 type SetterIpcam struct {
-	Target string `json:"target,omitempty"`
+	Target       string `json:"target,omitempty"`
+	SkipUrlCheck bool   `json:"skipUrlCheck,omitempty"`
 	Ipcam
 }
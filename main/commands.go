@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/empirefox/ic-client-one/storage"
+)
+
+var (
+	ErrUnknownSubcommand = errors.New("unknown subcommand")
+)
+
+// subcommands: ic-client-one <command> [args]
+var commands = map[string]func(args []string) error{
+	"cameras": runCameras,
+	"restore": runRestore,
+	"config":  runConfig,
+}
+
+func openConf(setup string) (*storage.Conf, error) {
+	conf, err := storage.NewConf(setup)
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.Open(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// cameras export [-o file] -setup setup.json
+// cameras import [-i file] [-mode merge|replace] [-dry-run] -setup setup.json
+func runCameras(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: cameras export|import -setup setup.json")
+	}
+	fs := flag.NewFlagSet("cameras "+args[0], flag.ContinueOnError)
+	setup := fs.String("setup", "", "setup json file path/content")
+
+	switch args[0] {
+	case "export":
+		out := fs.String("o", "", "output file, stdout if empty")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		conf, err := openConf(*setup)
+		if err != nil {
+			return err
+		}
+		defer conf.Close()
+
+		var w io.Writer = os.Stdout
+		if *out != "" {
+			f, err := os.Create(*out)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		return conf.ExportIpcams(w)
+
+	case "import":
+		in := fs.String("i", "", "input file, stdin if empty")
+		mode := fs.String("mode", string(storage.ImportMerge), "merge or replace")
+		dryRun := fs.Bool("dry-run", false, "only report the changes")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		conf, err := openConf(*setup)
+		if err != nil {
+			return err
+		}
+		defer conf.Close()
+
+		var r io.Reader = os.Stdin
+		if *in != "" {
+			f, err := os.Open(*in)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			r = f
+		}
+		result, err := conf.ImportIpcams(r, storage.ImportMode(*mode), *dryRun)
+		if err != nil {
+			return err
+		}
+		if *dryRun {
+			fmt.Println("dry run, nothing saved")
+		}
+		fmt.Println("added:", result.Added)
+		fmt.Println("updated:", result.Updated)
+		fmt.Println("removed:", result.Removed)
+		return nil
+	}
+	return ErrUnknownSubcommand
+}
+
+// restore [-from snapshot] -setup setup.json
+// restores the latest snapshot in BackupDir when -from is empty
+func runRestore(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	setup := fs.String("setup", "", "setup json file path/content")
+	from := fs.String("from", "", "snapshot file, latest in BackupDir if empty")
+	list := fs.Bool("list", false, "only list the snapshots")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	conf, err := storage.NewConf(*setup)
+	if err != nil {
+		return err
+	}
+
+	if *list {
+		snapshots, err := conf.Snapshots()
+		if err != nil {
+			return err
+		}
+		for _, s := range snapshots {
+			fmt.Println(s)
+		}
+		return nil
+	}
+
+	snapshot := *from
+	if snapshot == "" {
+		if snapshot, err = conf.LatestSnapshot(); err != nil {
+			return err
+		}
+	}
+	if err := conf.Restore(snapshot); err != nil {
+		return err
+	}
+	fmt.Println("restored from", snapshot)
+	return nil
+}
+
+// config validate -setup setup.json
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return errors.New("usage: config validate -setup setup.json")
+	}
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	file := fs.String("setup", "", "setup json file path/content")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	setup, err := storage.ParseSetup(*file)
+	if err != nil {
+		return err
+	}
+	report := setup.Check()
+	for _, p := range report.Problems {
+		fmt.Println(p.String())
+	}
+	if errs := report.Errors(); len(errs) != 0 {
+		return fmt.Errorf("setup has %d errors", len(errs))
+	}
+	fmt.Println("setup is valid")
+	return nil
+}
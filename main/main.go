@@ -3,6 +3,7 @@ package main
 import (
 	"bufio"
 	"flag"
+	"fmt"
 	"net/http"
 	"os"
 	"syscall"
@@ -15,6 +16,16 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			if err := run(os.Args[2:]); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	setup := flag.String("setup", "", "setup json file path/content")
 	flag.Parse()
 	c, err := center.NewCentral(*setup)
@@ -28,6 +39,8 @@ func main() {
 
 	router := gin.Default()
 	router.GET("/local", c.ServeLocal)
+	router.GET("/records/:camera/*file", c.ServeRecords)
+	router.HEAD("/records/:camera/*file", c.ServeRecords)
 
 	go readLineToQuit()
 
@@ -0,0 +1,324 @@
+package onvif
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	SOAP_TIMEOUT   = 5 * time.Second
+	maxSoapReply   = 1 << 20
+	soapEnvelopeNs = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+var (
+	ErrNoMediaService = errors.New("Device has no media service")
+	ErrNoProfile      = errors.New("Device has no media profile")
+	ErrUnauthorized   = errors.New("Device rejected the credentials")
+	ErrNoDeviceTime   = errors.New("Device has no UTC time")
+)
+
+// Fault is a SOAP fault returned by the device.
+type Fault struct {
+	Code   string
+	Reason string
+}
+
+func (f *Fault) Error() string {
+	return fmt.Sprintf("onvif fault %s: %s", f.Code, f.Reason)
+}
+
+var envelopeTemplate = template.Must(template.New("envelope").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<s:Envelope xmlns:s="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema" xmlns:tptz="http://www.onvif.org/ver20/ptz/wsdl">
+<s:Header>{{if .User}}
+<wsse:Security s:mustUnderstand="1" xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd" xmlns:wsu="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd">
+<wsse:UsernameToken>
+<wsse:Username>{{.User}}</wsse:Username>
+<wsse:Password Type="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest">{{.Digest}}</wsse:Password>
+<wsse:Nonce EncodingType="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary">{{.Nonce}}</wsse:Nonce>
+<wsu:Created>{{.Created}}</wsu:Created>
+</wsse:UsernameToken>
+</wsse:Security>{{end}}
+</s:Header>
+<s:Body>{{.Body}}</s:Body>
+</s:Envelope>`))
+
+type envelopeData struct {
+	User    string
+	Digest  string
+	Nonce   string
+	Created string
+	Body    string
+}
+
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// PasswordDigest is base64(sha1(nonce + created + password)).
+func PasswordDigest(nonce []byte, created, password string) string {
+	h := sha1.New()
+	h.Write(nonce)
+	io.WriteString(h, created)
+	io.WriteString(h, password)
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Client talks to the device service at XAddr.
+type Client struct {
+	XAddr    string
+	User     string
+	Password string
+	Http     *http.Client
+
+	// time offset to the device clock, the digest is checked against it.
+	// Set by SyncTime before the first authenticated call.
+	TimeOffset time.Duration
+	synced     bool
+}
+
+// SyncTime sets TimeOffset from the device clock, which is asked without
+// credentials as ONVIF allows.
+func (c *Client) SyncTime() error {
+	var reply struct {
+		Year   int `xml:"SystemDateAndTime>UTCDateTime>Date>Year"`
+		Month  int `xml:"SystemDateAndTime>UTCDateTime>Date>Month"`
+		Day    int `xml:"SystemDateAndTime>UTCDateTime>Date>Day"`
+		Hour   int `xml:"SystemDateAndTime>UTCDateTime>Time>Hour"`
+		Minute int `xml:"SystemDateAndTime>UTCDateTime>Time>Minute"`
+		Second int `xml:"SystemDateAndTime>UTCDateTime>Time>Second"`
+	}
+	c.synced = true
+	anon := &Client{XAddr: c.XAddr, Http: c.Http, synced: true}
+	if err := anon.call(c.XAddr, `<tds:GetSystemDateAndTime/>`, &reply); err != nil {
+		return err
+	}
+	if reply.Year == 0 {
+		return ErrNoDeviceTime
+	}
+	device := time.Date(reply.Year, time.Month(reply.Month), reply.Day, reply.Hour, reply.Minute, reply.Second, 0, time.UTC)
+	c.TimeOffset = device.Sub(time.Now())
+	return nil
+}
+
+func (c *Client) envelope(body string) ([]byte, error) {
+	data := envelopeData{User: escape(c.User), Body: body}
+	if c.User != "" {
+		nonce := make([]byte, 16)
+		rand.Read(nonce)
+		data.Created = time.Now().Add(c.TimeOffset).UTC().Format("2006-01-02T15:04:05.000Z")
+		data.Nonce = base64.StdEncoding.EncodeToString(nonce)
+		data.Digest = PasswordDigest(nonce, data.Created, c.Password)
+	}
+	var b bytes.Buffer
+	if err := envelopeTemplate.Execute(&b, data); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// call posts body to addr and decodes the soap body into reply.
+func (c *Client) call(addr, body string, reply interface{}) error {
+	if c.User != "" && !c.synced {
+		if err := c.SyncTime(); err != nil {
+			glog.Warningln("onvif: cannot get device time, local clock used:", err)
+		}
+	}
+	req, err := c.envelope(body)
+	if err != nil {
+		return err
+	}
+	hc := c.Http
+	if hc == nil {
+		hc = &http.Client{Timeout: SOAP_TIMEOUT}
+	}
+	res, err := hc.Post(addr, "application/soap+xml; charset=utf-8", bytes.NewReader(req))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(res.Body, maxSoapReply))
+	if err != nil {
+		return err
+	}
+	if res.StatusCode == http.StatusUnauthorized {
+		return ErrUnauthorized
+	}
+
+	var env struct {
+		Body struct {
+			Fault *struct {
+				Code   string `xml:"Code>Subcode>Value"`
+				Value  string `xml:"Code>Value"`
+				Reason string `xml:"Reason>Text"`
+			} `xml:"Fault"`
+			Inner []byte `xml:",innerxml"`
+		} `xml:"Body"`
+	}
+	if err := xml.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("onvif: bad reply with status %d: %v", res.StatusCode, err)
+	}
+	if f := env.Body.Fault; f != nil {
+		code := f.Code
+		if code == "" {
+			code = f.Value
+		}
+		if strings.HasSuffix(code, "NotAuthorized") || strings.HasSuffix(code, "FailedAuthentication") {
+			return ErrUnauthorized
+		}
+		return &Fault{Code: code, Reason: strings.TrimSpace(f.Reason)}
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("onvif: http status %d", res.StatusCode)
+	}
+	return xml.Unmarshal(env.Body.Inner, reply)
+}
+
+// capabilities asks the device for the address of every service category.
+func (c *Client) capabilities(category string) (map[string]string, error) {
+	var reply struct {
+		Capabilities struct {
+			Services []struct {
+				XMLName xml.Name
+				XAddr   string `xml:"XAddr"`
+			} `xml:",any"`
+		}
+	}
+	body := `<tds:GetCapabilities><tds:Category>` + category + `</tds:Category></tds:GetCapabilities>`
+	if err := c.call(c.XAddr, body, &reply); err != nil {
+		return nil, err
+	}
+	addrs := make(map[string]string, len(reply.Capabilities.Services))
+	for _, s := range reply.Capabilities.Services {
+		if addr := strings.TrimSpace(s.XAddr); addr != "" {
+			addrs[s.XMLName.Local] = addr
+		}
+	}
+	return addrs, nil
+}
+
+// capability returns "" when the device has no such service.
+func (c *Client) capability(category string) (string, error) {
+	addrs, err := c.capabilities(category)
+	return addrs[category], err
+}
+
+// MediaXAddr asks the device for its media service address.
+func (c *Client) MediaXAddr() (string, error) {
+	addr, err := c.capability("Media")
+	if err == nil && addr == "" {
+		err = ErrNoMediaService
+	}
+	return addr, err
+}
+
+// Profile is a media profile with its video encoder.
+type Profile struct {
+	Token    string
+	Name     string
+	Encoding string
+	Width    int
+	Height   int
+}
+
+func (c *Client) GetProfiles(mediaAddr string) ([]Profile, error) {
+	var reply struct {
+		Profiles []struct {
+			Token    string `xml:"token,attr"`
+			Name     string `xml:"Name"`
+			Encoding string `xml:"VideoEncoderConfiguration>Encoding"`
+			Width    int    `xml:"VideoEncoderConfiguration>Resolution>Width"`
+			Height   int    `xml:"VideoEncoderConfiguration>Resolution>Height"`
+		} `xml:"Profiles"`
+	}
+	if err := c.call(mediaAddr, `<trt:GetProfiles/>`, &reply); err != nil {
+		return nil, err
+	}
+	ps := make([]Profile, 0, len(reply.Profiles))
+	for _, p := range reply.Profiles {
+		// audio or metadata only
+		if p.Encoding == "" {
+			continue
+		}
+		ps = append(ps, Profile{
+			Token:    p.Token,
+			Name:     p.Name,
+			Encoding: p.Encoding,
+			Width:    p.Width,
+			Height:   p.Height,
+		})
+	}
+	return ps, nil
+}
+
+func (c *Client) GetStreamUri(mediaAddr, token string) (string, error) {
+	var reply struct {
+		Uri string `xml:"MediaUri>Uri"`
+	}
+	body := `<trt:GetStreamUri><trt:StreamSetup><tt:Stream>RTP-Unicast</tt:Stream>` +
+		`<tt:Transport><tt:Protocol>RTSP</tt:Protocol></tt:Transport></trt:StreamSetup>` +
+		`<trt:ProfileToken>` + escape(token) + `</trt:ProfileToken></trt:GetStreamUri>`
+	if err := c.call(mediaAddr, body, &reply); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(reply.Uri), nil
+}
+
+// Stream is a rtsp stream the ipcam Url can be set to.
+type Stream struct {
+	Profile  string `json:"profile"`
+	Name     string `json:"name"`
+	Uri      string `json:"uri"`
+	Encoding string `json:"encoding"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	// the first profile, others are sub streams
+	Main bool `json:"main"`
+}
+
+// Streams lists the rtsp stream of every video profile.
+func (c *Client) Streams() ([]Stream, error) {
+	mediaAddr, err := c.MediaXAddr()
+	if err != nil {
+		return nil, err
+	}
+	ps, err := c.GetProfiles(mediaAddr)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, ErrNoProfile
+	}
+	ss := make([]Stream, 0, len(ps))
+	for i, p := range ps {
+		uri, err := c.GetStreamUri(mediaAddr, p.Token)
+		if err != nil {
+			return nil, err
+		}
+		ss = append(ss, Stream{
+			Profile:  p.Token,
+			Name:     p.Name,
+			Uri:      uri,
+			Encoding: p.Encoding,
+			Width:    p.Width,
+			Height:   p.Height,
+			Main:     i == 0,
+		})
+	}
+	return ss, nil
+}
@@ -0,0 +1,187 @@
+package onvif
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	usernameRe = regexp.MustCompile(`<wsse:Username>([^<]*)<`)
+	passwordRe = regexp.MustCompile(`#PasswordDigest">([^<]*)<`)
+	nonceRe    = regexp.MustCompile(`#Base64Binary">([^<]*)<`)
+	createdRe  = regexp.MustCompile(`<wsu:Created>([^<]*)<`)
+)
+
+const soapReplyFormat = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope" xmlns:tds="http://www.onvif.org/ver10/device/wsdl" xmlns:trt="http://www.onvif.org/ver10/media/wsdl" xmlns:tt="http://www.onvif.org/ver10/schema" xmlns:tptz="http://www.onvif.org/ver20/ptz/wsdl">
+<SOAP-ENV:Body>%s</SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`
+
+const faultNotAuthorized = `<SOAP-ENV:Fault><SOAP-ENV:Code><SOAP-ENV:Value>SOAP-ENV:Sender</SOAP-ENV:Value>
+<SOAP-ENV:Subcode><SOAP-ENV:Value>ter:NotAuthorized</SOAP-ENV:Value></SOAP-ENV:Subcode></SOAP-ENV:Code>
+<SOAP-ENV:Reason><SOAP-ENV:Text xml:lang="en">Sender not Authorized</SOAP-ENV:Text></SOAP-ENV:Reason></SOAP-ENV:Fault>`
+
+func match(re *regexp.Regexp, s string) string {
+	if m := re.FindStringSubmatch(s); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+type stub struct {
+	*httptest.Server
+	// ptz requests in order
+	ptz []string
+	// device clock to the local one
+	skew time.Duration
+}
+
+// newStub serves the device, media and ptz services like a camera with a
+// main, a sub and an audio only profile. Digests created more than a minute
+// away from the device clock are rejected.
+func newStub(t *testing.T, user, password string) *stub {
+	ts := new(stub)
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		req := string(data)
+		now := time.Now().Add(ts.skew).UTC()
+
+		if strings.Contains(req, "<tds:GetSystemDateAndTime/>") {
+			fmt.Fprintf(w, soapReplyFormat, `<tds:GetSystemDateAndTimeResponse><tds:SystemDateAndTime>`+
+				`<tt:DateTimeType>NTP</tt:DateTimeType><tt:DaylightSavings>false</tt:DaylightSavings><tt:UTCDateTime>`+
+				now.Format(`<tt:Time><tt:Hour>15</tt:Hour><tt:Minute>04</tt:Minute><tt:Second>05</tt:Second></tt:Time>`)+
+				now.Format(`<tt:Date><tt:Year>2006</tt:Year><tt:Month>01</tt:Month><tt:Day>02</tt:Day></tt:Date>`)+
+				`</tt:UTCDateTime></tds:SystemDateAndTime></tds:GetSystemDateAndTimeResponse>`)
+			return
+		}
+
+		created := match(createdRe, req)
+		nonce, _ := base64.StdEncoding.DecodeString(match(nonceRe, req))
+		digest := PasswordDigest(nonce, created, password)
+		ct, _ := time.Parse(time.RFC3339, created)
+		if match(usernameRe, req) != user || match(passwordRe, req) != digest || ct.Sub(now) > time.Minute || now.Sub(ct) > time.Minute {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, soapReplyFormat, faultNotAuthorized)
+			return
+		}
+
+		var body string
+		switch {
+		case r.URL.Path == "/onvif/device_service" && strings.Contains(req, "<tds:GetCapabilities>"):
+			body = `<tds:GetCapabilitiesResponse><tds:Capabilities><tt:Media><tt:XAddr>` +
+				ts.URL + `/onvif/media</tt:XAddr></tt:Media><tt:PTZ><tt:XAddr>` +
+				ts.URL + `/onvif/ptz</tt:XAddr></tt:PTZ><tt:Events><tt:XAddr>` +
+				ts.URL + `/onvif/events</tt:XAddr></tt:Events><tt:Extension><tt:Other/></tt:Extension>` +
+				`</tds:Capabilities></tds:GetCapabilitiesResponse>`
+		case r.URL.Path == "/onvif/device_service" && strings.Contains(req, "<tds:GetDeviceInformation/>"):
+			body = `<tds:GetDeviceInformationResponse><tds:Manufacturer>Acme</tds:Manufacturer>` +
+				`<tds:Model>IPC-1</tds:Model><tds:FirmwareVersion>V5.4.0 build 170401</tds:FirmwareVersion>` +
+				`<tds:SerialNumber>SN001</tds:SerialNumber><tds:HardwareId>88</tds:HardwareId></tds:GetDeviceInformationResponse>`
+		case r.URL.Path == "/onvif/media" && strings.Contains(req, "<trt:GetProfiles/>"):
+			body = `<trt:GetProfilesResponse>
+<trt:Profiles token="main" fixed="true"><tt:Name>MainStream</tt:Name>
+<tt:VideoEncoderConfiguration token="v0"><tt:Encoding>H264</tt:Encoding>
+<tt:Resolution><tt:Width>1920</tt:Width><tt:Height>1080</tt:Height></tt:Resolution></tt:VideoEncoderConfiguration></trt:Profiles>
+<trt:Profiles token="audio"><tt:Name>Audio</tt:Name></trt:Profiles>
+<trt:Profiles token="sub"><tt:Name>SubStream</tt:Name>
+<tt:VideoEncoderConfiguration token="v1"><tt:Encoding>H264</tt:Encoding>
+<tt:Resolution><tt:Width>640</tt:Width><tt:Height>360</tt:Height></tt:Resolution></tt:VideoEncoderConfiguration></trt:Profiles>
+</trt:GetProfilesResponse>`
+		case r.URL.Path == "/onvif/media" && strings.Contains(req, "<trt:GetStreamUri>"):
+			token := match(regexp.MustCompile(`<trt:ProfileToken>([^<]*)<`), req)
+			body = `<trt:GetStreamUriResponse><trt:MediaUri><tt:Uri>rtsp://10.0.0.2:554/` +
+				token + `</tt:Uri></trt:MediaUri></trt:GetStreamUriResponse>`
+		case r.URL.Path == "/onvif/ptz":
+			op := match(regexp.MustCompile(`<tptz:(\w+)>`), req)
+			ts.ptz = append(ts.ptz, op+" "+match(regexp.MustCompile(`</tptz:ProfileToken>(.*)</tptz:`+op+`>`), req))
+			switch op {
+			case "GetPresets":
+				body = `<tptz:GetPresetsResponse><tptz:Preset token="1"><tt:Name>Gate</tt:Name></tptz:Preset>` +
+					`<tptz:Preset token="2"><tt:Name>Yard</tt:Name></tptz:Preset></tptz:GetPresetsResponse>`
+			case "SetPreset":
+				body = `<tptz:SetPresetResponse><tptz:PresetToken>3</tptz:PresetToken></tptz:SetPresetResponse>`
+			default:
+				body = `<tptz:` + op + `Response/>`
+			}
+		default:
+			t.Errorf("unexpected request to %s: %s\n", r.URL.Path, req)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fmt.Fprintf(w, soapReplyFormat, body)
+	}))
+	return ts
+}
+
+func TestClient_Streams(t *testing.T) {
+	ts := newStub(t, "admin", "secret")
+	defer ts.Close()
+
+	c := &Client{XAddr: ts.URL + "/onvif/device_service", User: "admin", Password: "secret"}
+	ss, err := c.Streams()
+	if err != nil {
+		t.Fatalf("Streams err: %v\n", err)
+	}
+	if len(ss) != 2 {
+		t.Fatalf("should skip audio profile, got: %+v\n", ss)
+	}
+	main, sub := ss[0], ss[1]
+	if !main.Main || main.Uri != "rtsp://10.0.0.2:554/main" || main.Width != 1920 || main.Encoding != "H264" {
+		t.Errorf("should get main stream, got: %+v\n", main)
+	}
+	if sub.Main || sub.Uri != "rtsp://10.0.0.2:554/sub" || sub.Height != 360 || sub.Name != "SubStream" {
+		t.Errorf("should get sub stream, got: %+v\n", sub)
+	}
+
+	c.Password = "wrong"
+	if _, err := c.Streams(); err != ErrUnauthorized {
+		t.Errorf("should get ErrUnauthorized, got: %v\n", err)
+	}
+}
+
+func TestClient_TimeOffset(t *testing.T) {
+	ts := newStub(t, "admin", "secret")
+	defer ts.Close()
+	ts.skew = 2 * time.Hour
+
+	c := &Client{XAddr: ts.URL + "/onvif/device_service", User: "admin", Password: "secret"}
+	if _, err := c.Streams(); err != nil {
+		t.Fatalf("should sync the device clock, err: %v\n", err)
+	}
+	if d := c.TimeOffset - ts.skew; d > 2*time.Second || d < -2*time.Second {
+		t.Errorf("offset should follow the device clock, got: %v\n", c.TimeOffset)
+	}
+}
+
+func TestClient_EscapeUser(t *testing.T) {
+	c := &Client{User: `a&<"b`, Password: "secret"}
+	env, err := c.envelope(`<tds:GetDeviceInformation/>`)
+	if err != nil {
+		t.Fatalf("envelope err: %v\n", err)
+	}
+	var v struct {
+		User string `xml:"Header>Security>UsernameToken>Username"`
+	}
+	if err := xml.Unmarshal(env, &v); err != nil {
+		t.Fatalf("envelope should be well formed, err: %v\n", err)
+	}
+	if v.User != c.User {
+		t.Errorf("username should be escaped, got: %q\n", v.User)
+	}
+}
+
+func TestPasswordDigest(t *testing.T) {
+	// example of the ONVIF core specification
+	nonce, _ := base64.StdEncoding.DecodeString("LKqI6G/AikKCQrN0zqZFlg==")
+	if d := PasswordDigest(nonce, "2010-09-16T07:50:45Z", "userpassword"); d != "tuOSpGlFlIXsozq4HFNeeGeFLEI=" {
+		t.Errorf("digest mismatch, got: %s\n", d)
+	}
+}
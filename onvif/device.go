@@ -0,0 +1,84 @@
+package onvif
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	FEATURE_ANALYTICS = "Analytics"
+	FEATURE_EVENTS    = "Events"
+	FEATURE_IMAGING   = "Imaging"
+	FEATURE_MEDIA     = "Media"
+	FEATURE_PTZ       = "PTZ"
+
+	PROBE_TIMEOUT = 3 * time.Second
+)
+
+var features = []string{FEATURE_ANALYTICS, FEATURE_EVENTS, FEATURE_IMAGING, FEATURE_MEDIA, FEATURE_PTZ}
+
+type DeviceInfo struct {
+	Manufacturer    string   `json:"manufacturer"`
+	Model           string   `json:"model"`
+	FirmwareVersion string   `json:"firmwareVersion"`
+	SerialNumber    string   `json:"serialNumber"`
+	HardwareId      string   `json:"hardwareId"`
+	Features        []string `json:"features"`
+}
+
+func (c *Client) DeviceInformation() (*DeviceInfo, error) {
+	var reply struct {
+		Manufacturer    string `xml:"Manufacturer"`
+		Model           string `xml:"Model"`
+		FirmwareVersion string `xml:"FirmwareVersion"`
+		SerialNumber    string `xml:"SerialNumber"`
+		HardwareId      string `xml:"HardwareId"`
+	}
+	if err := c.call(c.XAddr, `<tds:GetDeviceInformation/>`, &reply); err != nil {
+		return nil, err
+	}
+	return &DeviceInfo{
+		Manufacturer:    strings.TrimSpace(reply.Manufacturer),
+		Model:           strings.TrimSpace(reply.Model),
+		FirmwareVersion: strings.TrimSpace(reply.FirmwareVersion),
+		SerialNumber:    strings.TrimSpace(reply.SerialNumber),
+		HardwareId:      strings.TrimSpace(reply.HardwareId),
+	}, nil
+}
+
+// Features lists the known service categories the device has, sorted.
+func (c *Client) Features() ([]string, error) {
+	addrs, err := c.capabilities("All")
+	if err != nil {
+		return nil, err
+	}
+	fs := make([]string, 0, len(features))
+	for _, f := range features {
+		if addrs[f] != "" {
+			fs = append(fs, f)
+		}
+	}
+	return fs, nil
+}
+
+func (c *Client) Probe() (*DeviceInfo, error) {
+	info, err := c.DeviceInformation()
+	if err != nil {
+		return nil, err
+	}
+	if info.Features, err = c.Features(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Probe asks the camera streaming at rawurl about itself, see NewClient.
+func Probe(xaddr, rawurl string) (*DeviceInfo, error) {
+	c, err := NewClient(xaddr, rawurl)
+	if err != nil {
+		return nil, err
+	}
+	c.Http = &http.Client{Timeout: PROBE_TIMEOUT}
+	return c.Probe()
+}
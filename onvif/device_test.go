@@ -0,0 +1,28 @@
+package onvif
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClient_Probe(t *testing.T) {
+	ts := newStub(t, "admin", "secret")
+	defer ts.Close()
+
+	c := &Client{XAddr: ts.URL + "/onvif/device_service", User: "admin", Password: "secret"}
+	info, err := c.Probe()
+	if err != nil {
+		t.Fatalf("Probe err: %v\n", err)
+	}
+	want := &DeviceInfo{
+		Manufacturer:    "Acme",
+		Model:           "IPC-1",
+		FirmwareVersion: "V5.4.0 build 170401",
+		SerialNumber:    "SN001",
+		HardwareId:      "88",
+		Features:        []string{FEATURE_EVENTS, FEATURE_MEDIA, FEATURE_PTZ},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("unexpected device info: %+v\n", info)
+	}
+}
@@ -0,0 +1,176 @@
+package onvif
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const (
+	WS_DISCOVERY_ADDR    = "239.255.255.250:3702"
+	DISCOVERY_TIMEOUT    = 3 * time.Second
+	NVT_TYPE             = "dn:NetworkVideoTransmitter"
+	SCOPE_PREFIX         = "onvif://www.onvif.org/"
+	maxDiscoveryDatagram = 64 * 1024
+)
+
+var probeTemplate = template.Must(template.New("probe").Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<e:Envelope xmlns:e="http://www.w3.org/2003/05/soap-envelope" xmlns:w="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<e:Header>
+<w:MessageID>{{.}}</w:MessageID>
+<w:To e:mustUnderstand="true">urn:schemas-xmlsoap-org:ws:2005:04:discovery</w:To>
+<w:Action e:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</w:Action>
+</e:Header>
+<e:Body>
+<d:Probe><d:Types>` + NVT_TYPE + `</d:Types></d:Probe>
+</e:Body>
+</e:Envelope>`))
+
+// Device is a camera answered a probe.
+type Device struct {
+	// urn:uuid of the device, stable across address changes
+	EndpointRef string   `json:"endpointRef"`
+	XAddrs      []string `json:"xAddrs"`
+	Types       []string `json:"types,omitempty"`
+	Scopes      []string `json:"scopes,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Hardware    string   `json:"hardware,omitempty"`
+	Location    string   `json:"location,omitempty"`
+}
+
+// Host returns the host of the first device service address.
+func (d *Device) Host() string {
+	for _, x := range d.XAddrs {
+		if u, err := url.Parse(x); err == nil && u.Host != "" {
+			return hostname(u.Host)
+		}
+	}
+	return ""
+}
+
+func hostname(hostport string) string {
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		return h
+	}
+	return strings.Trim(hostport, "[]")
+}
+
+type probeMatches struct {
+	RelatesTo string `xml:"Header>RelatesTo"`
+	Matches   []struct {
+		Address string `xml:"EndpointReference>Address"`
+		Types   string `xml:"Types"`
+		Scopes  string `xml:"Scopes"`
+		XAddrs  string `xml:"XAddrs"`
+	} `xml:"Body>ProbeMatches>ProbeMatch"`
+}
+
+func newUuid() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("uuid:%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// Discover probes the LAN for ONVIF cameras.
+func Discover(timeout time.Duration) ([]Device, error) {
+	return DiscoverAt(WS_DISCOVERY_ADDR, timeout)
+}
+
+// DiscoverAt sends a probe to addr and gathers the matches until timeout.
+func DiscoverAt(addr string, timeout time.Duration) ([]Device, error) {
+	if timeout <= 0 {
+		timeout = DISCOVERY_TIMEOUT
+	}
+	raddr, err := net.ResolveUDPAddr("udp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	id := newUuid()
+	var probe bytes.Buffer
+	if err := probeTemplate.Execute(&probe, id); err != nil {
+		return nil, err
+	}
+	if _, err := conn.WriteToUDP(probe.Bytes(), raddr); err != nil {
+		return nil, err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	devices := make([]Device, 0)
+	seen := make(map[string]bool)
+	buf := make([]byte, maxDiscoveryDatagram)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return devices, nil
+			}
+			return devices, err
+		}
+		for _, d := range parseProbeMatches(buf[:n], id) {
+			key := d.EndpointRef
+			if key == "" {
+				key = strings.Join(d.XAddrs, " ")
+			}
+			if !seen[key] {
+				seen[key] = true
+				devices = append(devices, d)
+			}
+		}
+	}
+}
+
+// parseProbeMatches ignores replies to other probes, and broken ones.
+func parseProbeMatches(data []byte, messageId string) []Device {
+	var pm probeMatches
+	if err := xml.Unmarshal(data, &pm); err != nil || strings.TrimSpace(pm.RelatesTo) != messageId {
+		return nil
+	}
+	var ds []Device
+	for _, m := range pm.Matches {
+		d := Device{
+			EndpointRef: strings.TrimSpace(m.Address),
+			XAddrs:      strings.Fields(m.XAddrs),
+			Types:       strings.Fields(m.Types),
+			Scopes:      strings.Fields(m.Scopes),
+		}
+		for _, scope := range d.Scopes {
+			if !strings.HasPrefix(scope, SCOPE_PREFIX) {
+				continue
+			}
+			kv := strings.SplitN(strings.TrimPrefix(scope, SCOPE_PREFIX), "/", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v, err := url.PathUnescape(kv[1])
+			if err != nil {
+				v = kv[1]
+			}
+			switch kv[0] {
+			case "name":
+				d.Name = v
+			case "hardware":
+				d.Hardware = v
+			case "location":
+				d.Location = v
+			}
+		}
+		if len(d.XAddrs) != 0 {
+			ds = append(ds, d)
+		}
+	}
+	return ds
+}
@@ -0,0 +1,73 @@
+package onvif
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+var messageIdRe = regexp.MustCompile(`<w:MessageID>([^<]+)</w:MessageID>`)
+
+const probeMatchFormat = `<?xml version="1.0" encoding="UTF-8"?>
+<SOAP-ENV:Envelope xmlns:SOAP-ENV="http://www.w3.org/2003/05/soap-envelope" xmlns:wsa="http://schemas.xmlsoap.org/ws/2004/08/addressing" xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">
+<SOAP-ENV:Header><wsa:RelatesTo>%s</wsa:RelatesTo></SOAP-ENV:Header>
+<SOAP-ENV:Body><d:ProbeMatches><d:ProbeMatch>
+<wsa:EndpointReference><wsa:Address>urn:uuid:%s</wsa:Address></wsa:EndpointReference>
+<d:Types>dn:NetworkVideoTransmitter</d:Types>
+<d:Scopes>onvif://www.onvif.org/type/video_encoder onvif://www.onvif.org/name/Front%%20Door onvif://www.onvif.org/hardware/IPC-1 onvif://www.onvif.org/location/city/x</d:Scopes>
+<d:XAddrs>http://%s/onvif/device_service</d:XAddrs>
+</d:ProbeMatch></d:ProbeMatches></SOAP-ENV:Body>
+</SOAP-ENV:Envelope>`
+
+// respond answers every probe like two cameras, one of them twice,
+// and also replies to another probe.
+func respond(t *testing.T, conn *net.UDPConn) {
+	buf := make([]byte, 8192)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		m := messageIdRe.FindSubmatch(buf[:n])
+		if m == nil {
+			t.Errorf("probe without MessageID: %s\n", buf[:n])
+			continue
+		}
+		id := string(m[1])
+		for _, reply := range []string{
+			fmt.Sprintf(probeMatchFormat, id, "cam-1", "192.168.1.10"),
+			fmt.Sprintf(probeMatchFormat, id, "cam-1", "192.168.1.10"),
+			fmt.Sprintf(probeMatchFormat, id, "cam-2", "192.168.1.11:8080"),
+			fmt.Sprintf(probeMatchFormat, "uuid:other", "cam-3", "192.168.1.12"),
+			"not xml",
+		} {
+			conn.WriteToUDP([]byte(reply), from)
+		}
+	}
+}
+
+func TestDiscoverAt(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skip("cannot listen udp:", err)
+	}
+	defer conn.Close()
+	go respond(t, conn)
+
+	ds, err := DiscoverAt(conn.LocalAddr().String(), 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("DiscoverAt err: %v\n", err)
+	}
+	if len(ds) != 2 {
+		t.Fatalf("should find 2 devices, got: %+v\n", ds)
+	}
+	d := ds[0]
+	if d.EndpointRef != "urn:uuid:cam-1" || d.Name != "Front Door" || d.Hardware != "IPC-1" || d.Location != "city/x" {
+		t.Errorf("should parse scopes, got: %+v\n", d)
+	}
+	if d.Host() != "192.168.1.10" || ds[1].Host() != "192.168.1.11" {
+		t.Errorf("should get hosts, got: %s %s\n", d.Host(), ds[1].Host())
+	}
+}
@@ -0,0 +1,161 @@
+package onvif
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+)
+
+const (
+	DEVICE_SERVICE_PATH = "/onvif/device_service"
+)
+
+var ErrNoPTZService = errors.New("Device has no PTZ service")
+
+// ClientFromUrl guesses the device service of the camera streaming at
+// rawurl, on the default http port, with the credentials of rawurl.
+func ClientFromUrl(rawurl string) (*Client, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	host := hostname(u.Host)
+	if host == "" {
+		return nil, fmt.Errorf("onvif: no host in url")
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.To4() == nil {
+		host = "[" + host + "]"
+	}
+	c := &Client{XAddr: "http://" + host + DEVICE_SERVICE_PATH}
+	if u.User != nil {
+		c.User = u.User.Username()
+		c.Password, _ = u.User.Password()
+	}
+	return c, nil
+}
+
+// NewClient talks to the device service at xaddr with the credentials of
+// rawurl. An empty xaddr is guessed by ClientFromUrl.
+func NewClient(xaddr, rawurl string) (*Client, error) {
+	if xaddr == "" {
+		return ClientFromUrl(rawurl)
+	}
+	c := &Client{XAddr: xaddr}
+	if u, err := url.Parse(rawurl); err == nil && u.User != nil {
+		c.User = u.User.Username()
+		c.Password, _ = u.User.Password()
+	}
+	return c, nil
+}
+
+// Velocity components are within [-1, 1], 0 leaves the axis still.
+type Velocity struct {
+	Pan  float64 `json:"pan"`
+	Tilt float64 `json:"tilt"`
+	Zoom float64 `json:"zoom"`
+}
+
+func clamp(v float64) float64 {
+	if v > 1 {
+		return 1
+	}
+	if v < -1 {
+		return -1
+	}
+	return v
+}
+
+type Preset struct {
+	Token string `json:"token"`
+	Name  string `json:"name"`
+}
+
+// PTZ controls the first video profile of a device.
+type PTZ struct {
+	c       *Client
+	Addr    string
+	Profile string
+}
+
+func (c *Client) PTZ() (*PTZ, error) {
+	addr, err := c.capability("PTZ")
+	if err != nil {
+		return nil, err
+	}
+	if addr == "" {
+		return nil, ErrNoPTZService
+	}
+	mediaAddr, err := c.MediaXAddr()
+	if err != nil {
+		return nil, err
+	}
+	ps, err := c.GetProfiles(mediaAddr)
+	if err != nil {
+		return nil, err
+	}
+	if len(ps) == 0 {
+		return nil, ErrNoProfile
+	}
+	return &PTZ{c: c, Addr: addr, Profile: ps[0].Token}, nil
+}
+
+func (p *PTZ) profile() string {
+	return `<tptz:ProfileToken>` + escape(p.Profile) + `</tptz:ProfileToken>`
+}
+
+// ContinuousMove moves until Stop, or until timeout when it is not 0.
+func (p *PTZ) ContinuousMove(v Velocity, timeout time.Duration) error {
+	body := fmt.Sprintf(`<tptz:ContinuousMove>%s`+
+		`<tptz:Velocity><tt:PanTilt x="%g" y="%g"/><tt:Zoom x="%g"/></tptz:Velocity>`,
+		p.profile(), clamp(v.Pan), clamp(v.Tilt), clamp(v.Zoom))
+	if timeout > 0 {
+		body += fmt.Sprintf(`<tptz:Timeout>PT%gS</tptz:Timeout>`, timeout.Seconds())
+	}
+	body += `</tptz:ContinuousMove>`
+	return p.c.call(p.Addr, body, &struct{}{})
+}
+
+func (p *PTZ) Stop() error {
+	body := `<tptz:Stop>` + p.profile() +
+		`<tptz:PanTilt>true</tptz:PanTilt><tptz:Zoom>true</tptz:Zoom></tptz:Stop>`
+	return p.c.call(p.Addr, body, &struct{}{})
+}
+
+func (p *PTZ) Presets() ([]Preset, error) {
+	var reply struct {
+		Presets []struct {
+			Token string `xml:"token,attr"`
+			Name  string `xml:"Name"`
+		} `xml:"Preset"`
+	}
+	body := `<tptz:GetPresets>` + p.profile() + `</tptz:GetPresets>`
+	if err := p.c.call(p.Addr, body, &reply); err != nil {
+		return nil, err
+	}
+	ps := make([]Preset, 0, len(reply.Presets))
+	for _, r := range reply.Presets {
+		ps = append(ps, Preset{Token: r.Token, Name: r.Name})
+	}
+	return ps, nil
+}
+
+func (p *PTZ) GotoPreset(token string) error {
+	body := `<tptz:GotoPreset>` + p.profile() +
+		`<tptz:PresetToken>` + escape(token) + `</tptz:PresetToken></tptz:GotoPreset>`
+	return p.c.call(p.Addr, body, &struct{}{})
+}
+
+// SetPreset saves the current position as name, returns the preset token.
+func (p *PTZ) SetPreset(name string) (string, error) {
+	var reply struct {
+		Token string `xml:"PresetToken"`
+	}
+	body := `<tptz:SetPreset>` + p.profile() +
+		`<tptz:PresetName>` + escape(name) + `</tptz:PresetName></tptz:SetPreset>`
+	if err := p.c.call(p.Addr, body, &reply); err != nil {
+		return "", err
+	}
+	return reply.Token, nil
+}
@@ -0,0 +1,101 @@
+package records
+
+import (
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+const (
+	DISK_CHECK_INTERVAL = time.Minute
+	// clear rec_write_error after this many good probes in a row
+	DISK_WRITE_OK_ROUNDS = 2
+)
+
+// Disk statuses
+const (
+	DISK_OK         = "disk_ok"
+	DISK_LOW        = "disk_low"
+	REC_WRITE_ERROR = "rec_write_error"
+)
+
+type DiskReport struct {
+	Status string `json:"status"`
+	Dir    string `json:"dir"`
+	Free   int64  `json:"free"`
+	Error  string `json:"error,omitempty"`
+}
+
+// DiskMonitor turns disk_low on below LowBytes, and off only at OkBytes
+// or more, so a disk around the threshold does not flap.
+// rec_write_error wins over disk_low.
+type DiskMonitor struct {
+	Dir      string
+	LowBytes int64
+	OkBytes  int64
+
+	status   string
+	lowDisk  bool
+	writeOk  int
+	writeErr error
+}
+
+func NewDiskMonitor(dir string, low, ok int64) *DiskMonitor {
+	if ok < low {
+		ok = low
+	}
+	return &DiskMonitor{Dir: dir, LowBytes: low, OkBytes: ok, status: DISK_OK, writeOk: DISK_WRITE_OK_ROUNDS}
+}
+
+// Check probes Dir, and reports when the status changed.
+// Not safe for concurrent use.
+func (m *DiskMonitor) Check() (*DiskReport, bool) {
+	free, err := FreeBytes(m.Dir)
+	if err == nil {
+		err = probeWrite(m.Dir)
+	}
+	return m.update(free, err)
+}
+
+func (m *DiskMonitor) update(free int64, err error) (*DiskReport, bool) {
+	if err != nil {
+		m.writeOk, m.writeErr = 0, err
+	} else if m.writeOk < DISK_WRITE_OK_ROUNDS {
+		m.writeOk++
+	}
+	if err == nil && m.LowBytes > 0 {
+		if free < m.LowBytes {
+			m.lowDisk = true
+		} else if free >= m.OkBytes {
+			m.lowDisk = false
+		}
+	}
+
+	status := DISK_OK
+	switch {
+	case m.writeOk < DISK_WRITE_OK_ROUNDS:
+		status = REC_WRITE_ERROR
+	case m.lowDisk:
+		status = DISK_LOW
+	}
+	r := &DiskReport{Status: status, Dir: m.Dir, Free: free}
+	if status == REC_WRITE_ERROR {
+		r.Error = m.writeErr.Error()
+	}
+	changed := status != m.status
+	m.status = status
+	return r, changed
+}
+
+func probeWrite(dir string) error {
+	f, err := ioutil.TempFile(dir, ".ic-client-probe-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write([]byte("probe"))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	os.Remove(f.Name())
+	return err
+}
@@ -0,0 +1,57 @@
+package records
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestDiskMonitor_Hysteresis(t *testing.T) {
+	m := NewDiskMonitor("/rec", 100, 150)
+	steps := []struct {
+		free    int64
+		err     error
+		status  string
+		changed bool
+	}{
+		{200, nil, DISK_OK, false},
+		{99, nil, DISK_LOW, true},
+		{120, nil, DISK_LOW, false},
+		{99, nil, DISK_LOW, false},
+		{150, nil, DISK_OK, true},
+		{120, nil, DISK_OK, false},
+		{0, errors.New("read-only"), REC_WRITE_ERROR, true},
+		{120, nil, REC_WRITE_ERROR, false},
+		{120, nil, DISK_OK, true},
+		{99, errors.New("full"), REC_WRITE_ERROR, true},
+		{99, nil, REC_WRITE_ERROR, false},
+		{99, nil, DISK_LOW, true},
+	}
+	for i, s := range steps {
+		r, changed := m.update(s.free, s.err)
+		if r.Status != s.status || changed != s.changed {
+			t.Errorf("step %d should be %s %v, got: %s %v\n", i, s.status, s.changed, r.Status, changed)
+		}
+		if s.status == REC_WRITE_ERROR && r.Error == "" {
+			t.Errorf("step %d should report the write error\n", i)
+		}
+	}
+}
+
+func TestDiskMonitor_Check(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ic-client-one-disk-")
+	defer os.RemoveAll(dir)
+
+	m := NewDiskMonitor(dir, 1, 1)
+	if r, changed := m.Check(); r.Status != DISK_OK || changed || r.Free <= 0 {
+		t.Errorf("should be ok, got: %+v\n", r)
+	}
+	if fs, _ := ioutil.ReadDir(dir); len(fs) != 0 {
+		t.Errorf("should remove the probe file\n")
+	}
+	m.Dir = dir + "/none"
+	if r, changed := m.Check(); r.Status != REC_WRITE_ERROR || !changed {
+		t.Errorf("should report write error, got: %+v\n", r)
+	}
+}
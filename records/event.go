@@ -0,0 +1,133 @@
+package records
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	EVENTS_FILE      = ".events"
+	EVENT_PRE_ROLL   = 5 * time.Second
+	EVENT_POST_ROLL  = 30 * time.Second
+	EVENT_MAX_LENGTH = 10 * time.Minute
+)
+
+// Event is a triggered clip, End is extended by overlapping triggers.
+type Event struct {
+	Camera  string   `json:"camera"`
+	Start   int64    `json:"start"`
+	End     int64    `json:"end"`
+	Reasons []string `json:"reasons"`
+}
+
+func (e *Event) AddReason(reason string) {
+	for _, r := range e.Reasons {
+		if r == reason {
+			return
+		}
+	}
+	e.Reasons = append(e.Reasons, reason)
+}
+
+func (e *Event) overlaps(start, end int64) bool { return e.Start <= end && e.End >= start }
+
+func eventsFile(recDir, camera string) string {
+	return filepath.Join(recDir, camera, EVENTS_FILE)
+}
+
+// PutEvent saves e, a later put of the same Camera and Start replaces it.
+// Events are kept as json lines in RecDir/<camera>/.events.
+func (x *Index) PutEvent(e Event) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	es := x.events[e.Camera]
+	replaced := false
+	for i := range es {
+		if es[i].Start == e.Start {
+			es[i], replaced = e, true
+		}
+	}
+	if !replaced {
+		es = append(es, e)
+	}
+	x.events[e.Camera] = es
+
+	name := eventsFile(x.dir, e.Camera)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(&e)
+}
+
+// loadEvents reads the events of camera, the last line of a Start wins.
+func loadEvents(name string) ([]Event, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	byStart := make(map[int64]Event)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e Event
+		if json.Unmarshal(scanner.Bytes(), &e) == nil {
+			byStart[e.Start] = e
+		}
+	}
+	es := make([]Event, 0, len(byStart))
+	for _, e := range byStart {
+		es = append(es, e)
+	}
+	sort.Slice(es, func(i, j int) bool { return es[i].Start < es[j].Start })
+	return es, scanner.Err()
+}
+
+// compactEvents rewrites the events file when lines can be dropped,
+// like events of recordings already removed.
+func compactEvents(name string, es []Event, lines int) error {
+	if lines <= len(es) {
+		return nil
+	}
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	for i := range es {
+		if err = enc.Encode(&es[i]); err != nil {
+			break
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func countLines(name string) int {
+	f, err := os.Open(name)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,60 @@
+package records
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestIndex_Events(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ic-client-one-event-")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "cam1"), 0755)
+
+	base := time.Now().Add(-5 * time.Hour).Truncate(time.Second)
+	for i := 0; i < 3; i++ {
+		start := base.Add(time.Duration(i) * time.Hour)
+		p := filepath.Join(dir, "cam1", start.Format("20060102-150405")+".mkv")
+		ioutil.WriteFile(p, []byte("data"), 0644)
+		end := start.Add(time.Hour)
+		os.Chtimes(p, end, end)
+	}
+
+	x := NewIndex(dir)
+	old := Event{Camera: "cam1", Start: base.Add(-2 * time.Hour).Unix(), End: base.Add(-time.Hour).Unix(), Reasons: []string{"door"}}
+	e := Event{Camera: "cam1", Start: base.Add(70 * time.Minute).Unix(), Reasons: []string{"door"}}
+	e.End = e.Start + 60
+	for _, ev := range []Event{old, e} {
+		if err := x.PutEvent(ev); err != nil {
+			t.Fatalf("PutEvent err: %v\n", err)
+		}
+	}
+	// extended by another trigger
+	e.End = base.Add(130 * time.Minute).Unix()
+	e.AddReason("motion")
+	e.AddReason("door")
+	x.PutEvent(e)
+
+	x.Update([]string{"cam1"})
+	page := x.List(Query{Camera: "cam1"})
+	if page.Total != 3 || len(page.Records[0].Reasons) != 0 || len(page.Records[1].Reasons) != 2 || len(page.Records[2].Reasons) != 2 {
+		t.Errorf("should tag records overlapping the clip, got: %+v\n", page.Records)
+	}
+	if page = x.List(Query{Reason: "motion"}); page.Total != 2 {
+		t.Errorf("should filter by reason, got: %+v\n", page)
+	}
+
+	es, _ := loadEvents(eventsFile(dir, "cam1"))
+	if len(es) != 1 || es[0].End != e.End || countLines(eventsFile(dir, "cam1")) != 1 {
+		t.Errorf("should compact and drop events before the oldest record, got: %+v\n", es)
+	}
+
+	// survives a new index
+	x = NewIndex(dir)
+	x.Update([]string{"cam1"})
+	if page = x.List(Query{Reason: "door"}); page.Total != 2 {
+		t.Errorf("should load events from RecDir, got: %+v\n", page)
+	}
+}
@@ -0,0 +1,269 @@
+package records
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	INDEX_INTERVAL = time.Minute
+	LIST_LIMIT     = 100
+	LIST_MAX_LIMIT = 1000
+)
+
+// Record is an indexed segment. Path is relative to RecDir.
+// Start comes from a time in the file name when there is one,
+// otherwise it equals End, the last write.
+type Record struct {
+	Camera string `json:"camera"`
+	Path   string `json:"path"`
+	Start  int64  `json:"start"`
+	End    int64  `json:"end"`
+	Size   int64  `json:"size"`
+	// of the event clips overlapping the record
+	Reasons []string `json:"reasons,omitempty"`
+
+	modTime time.Time
+}
+
+// Query matches records of Camera overlapping From to To, zero is unbounded.
+type Query struct {
+	Camera string `json:"camera,omitempty"`
+	From   int64  `json:"from,omitempty"`
+	To     int64  `json:"to,omitempty"`
+	// only records of event clips with the reason
+	Reason string `json:"reason,omitempty"`
+	Offset int    `json:"offset,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+type Page struct {
+	Total   int      `json:"total"`
+	Offset  int      `json:"offset"`
+	Records []Record `json:"records"`
+}
+
+func (r *Record) hasReason(reason string) bool {
+	for _, s := range r.Reasons {
+		if s == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Record) addReason(reason string) {
+	if !r.hasReason(reason) {
+		r.Reasons = append(r.Reasons, reason)
+	}
+}
+
+// Index lists the recordings in RecDir. It is safe for concurrent use.
+type Index struct {
+	dir     string
+	mu      sync.RWMutex
+	records map[string]Record
+	events  map[string][]Event
+	updated time.Time
+}
+
+func NewIndex(recDir string) *Index {
+	return &Index{dir: recDir, records: make(map[string]Record), events: make(map[string][]Event)}
+}
+
+// Update rescans RecDir, only new or changed files are parsed again.
+func (x *Index) Update(ids []string) error {
+	segs, err := Scan(x.dir, ids)
+	if err != nil {
+		return err
+	}
+	x.mu.RLock()
+	old := x.records
+	x.mu.RUnlock()
+
+	records := make(map[string]Record, len(old))
+	for _, ss := range segs {
+		for _, s := range ss {
+			rel, err := filepath.Rel(x.dir, s.Path)
+			if err != nil {
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			if r, ok := old[rel]; ok && r.Size == s.Size && r.modTime.Equal(s.ModTime) {
+				records[rel] = r
+				continue
+			}
+			records[rel] = newRecord(rel, s)
+		}
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.records = records
+	x.updated = time.Now()
+	x.loadEvents(segs)
+	return nil
+}
+
+// loadEvents drops the events ending before the oldest record of a camera.
+func (x *Index) loadEvents(segs map[string][]Segment) {
+	cameras := make(map[string]bool)
+	for camera := range segs {
+		cameras[camera] = true
+	}
+	for camera := range x.events {
+		cameras[camera] = true
+	}
+	for camera := range cameras {
+		name := eventsFile(x.dir, camera)
+		es, err := loadEvents(name)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				glog.Errorln(err)
+			}
+			continue
+		}
+		if ss := segs[camera]; len(ss) != 0 {
+			oldest := ss[0].ModTime.Unix()
+			if t, ok := parseNameTime(filepath.Base(ss[0].Path)); ok && t.Unix() < oldest {
+				oldest = t.Unix()
+			}
+			kept := es[:0]
+			for _, e := range es {
+				if e.End >= oldest {
+					kept = append(kept, e)
+				}
+			}
+			es = kept
+		}
+		if err := compactEvents(name, es, countLines(name)); err != nil {
+			glog.Errorln(err)
+		}
+		x.events[camera] = es
+	}
+}
+
+func newRecord(rel string, s Segment) Record {
+	r := Record{Camera: s.Camera, Path: rel, End: s.ModTime.Unix(), Size: s.Size, modTime: s.ModTime}
+	r.Start = r.End
+	if t, ok := parseNameTime(filepath.Base(rel)); ok && t.Unix() <= r.End {
+		r.Start = t.Unix()
+	}
+	return r
+}
+
+// parseNameTime finds 20060102150405, 20060102-150405 or unix seconds in name.
+func parseNameTime(name string) (time.Time, bool) {
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	tokens := strings.FieldsFunc(name, func(c rune) bool { return c < '0' || c > '9' })
+	for i, tok := range tokens {
+		switch len(tok) {
+		case 14:
+			if t, err := time.ParseInLocation("20060102150405", tok, time.Local); err == nil {
+				return t, true
+			}
+		case 8:
+			if i+1 < len(tokens) && len(tokens[i+1]) == 6 {
+				if t, err := time.ParseInLocation("20060102150405", tok+tokens[i+1], time.Local); err == nil {
+					return t, true
+				}
+			}
+		case 10:
+			if n, err := strconv.ParseInt(tok, 10, 64); err == nil {
+				return time.Unix(n, 0), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Remove drops paths, like the ones removed by retention.
+// Absolute paths must be inside RecDir.
+func (x *Index) Remove(paths ...string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for _, p := range paths {
+		if filepath.IsAbs(p) {
+			rel, err := filepath.Rel(x.dir, p)
+			if err != nil {
+				continue
+			}
+			p = rel
+		}
+		delete(x.records, filepath.ToSlash(p))
+	}
+}
+
+// Lookup finds the record of p, relative to RecDir.
+func (x *Index) Lookup(p string) (Record, bool) {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	r, ok := x.records[p]
+	return r, ok
+}
+
+func (x *Index) Updated() time.Time {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.updated
+}
+
+// List returns the matched records ordered by Start.
+func (x *Index) List(q Query) *Page {
+	if q.Limit <= 0 {
+		q.Limit = LIST_LIMIT
+	} else if q.Limit > LIST_MAX_LIMIT {
+		q.Limit = LIST_MAX_LIMIT
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+
+	x.mu.RLock()
+	var matched []Record
+	for _, r := range x.records {
+		if q.Camera != "" && r.Camera != q.Camera {
+			continue
+		}
+		if (q.From != 0 && r.End < q.From) || (q.To != 0 && r.Start > q.To) {
+			continue
+		}
+		r.Reasons = nil
+		for _, e := range x.events[r.Camera] {
+			if e.overlaps(r.Start, r.End) {
+				for _, reason := range e.Reasons {
+					r.addReason(reason)
+				}
+			}
+		}
+		if q.Reason != "" && !r.hasReason(q.Reason) {
+			continue
+		}
+		matched = append(matched, r)
+	}
+	x.mu.RUnlock()
+
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].Start != matched[j].Start {
+			return matched[i].Start < matched[j].Start
+		}
+		return matched[i].Path < matched[j].Path
+	})
+
+	page := &Page{Total: len(matched), Offset: q.Offset, Records: make([]Record, 0)}
+	if q.Offset < len(matched) {
+		end := q.Offset + q.Limit
+		if end > len(matched) {
+			end = len(matched)
+		}
+		page.Records = append(page.Records, matched[q.Offset:end]...)
+	}
+	return page
+}
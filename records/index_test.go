@@ -0,0 +1,82 @@
+package records
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseNameTime(t *testing.T) {
+	want := time.Date(2016, 1, 2, 15, 4, 5, 0, time.Local)
+	for _, name := range []string{"cam1-20160102150405.mkv", "20160102-150405.mkv", "cam1_20160102_150405.mp4"} {
+		if got, ok := parseNameTime(name); !ok || !got.Equal(want) {
+			t.Errorf("should parse %s, got: %v\n", name, got)
+		}
+	}
+	if got, ok := parseNameTime("cam1-1451747045.mkv"); !ok || got.Unix() != 1451747045 {
+		t.Errorf("should parse unix time, got: %v\n", got)
+	}
+	if _, ok := parseNameTime("cam1.mkv"); ok {
+		t.Errorf("should not parse a name without time\n")
+	}
+}
+
+func TestIndex(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ic-client-one-index-")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "cam1"), 0755)
+	os.MkdirAll(filepath.Join(dir, "cam2"), 0755)
+
+	base := time.Now().Add(-10 * time.Hour).Truncate(time.Second)
+	write := func(name string, end time.Time) {
+		p := filepath.Join(dir, name)
+		ioutil.WriteFile(p, []byte("data"), 0644)
+		os.Chtimes(p, end, end)
+	}
+	for i := 0; i < 5; i++ {
+		start := base.Add(time.Duration(i) * time.Hour)
+		write("cam1/"+start.Format("20060102-150405")+".mkv", start.Add(time.Hour))
+	}
+	write("cam2/a.mkv", base.Add(30*time.Minute))
+
+	x := NewIndex(dir)
+	if err := x.Update([]string{"cam1", "cam2"}); err != nil {
+		t.Fatalf("Update err: %v\n", err)
+	}
+
+	page := x.List(Query{})
+	if page.Total != 6 || len(page.Records) != 6 || page.Records[0].Start != base.Unix() {
+		t.Errorf("should list every record by start, got: %+v\n", page)
+	}
+	if r := page.Records[0]; r.Camera != "cam1" || r.End != base.Add(time.Hour).Unix() || r.Size != 4 {
+		t.Errorf("should get start, end and size, got: %+v\n", r)
+	}
+
+	page = x.List(Query{Camera: "cam1", From: base.Add(90 * time.Minute).Unix(), To: base.Add(150 * time.Minute).Unix()})
+	if page.Total != 2 {
+		t.Errorf("should filter by camera and time range, got: %+v\n", page)
+	}
+
+	page = x.List(Query{Camera: "cam1", Offset: 3, Limit: 10})
+	if page.Total != 5 || len(page.Records) != 2 || page.Offset != 3 {
+		t.Errorf("should page records, got: %+v\n", page)
+	}
+	if page = x.List(Query{Offset: 10}); len(page.Records) != 0 || page.Records == nil {
+		t.Errorf("should get empty page after the end, got: %+v\n", page)
+	}
+
+	os.Remove(filepath.Join(dir, "cam2/a.mkv"))
+	write("cam2/b.mkv", time.Now())
+	x.Update([]string{"cam1", "cam2"})
+	page = x.List(Query{Camera: "cam2"})
+	if page.Total != 1 || page.Records[0].Path != "cam2/b.mkv" {
+		t.Errorf("should follow changes in RecDir, got: %+v\n", page)
+	}
+
+	x.Remove(filepath.Join(dir, "cam2/b.mkv"))
+	if page = x.List(Query{Camera: "cam2"}); page.Total != 0 {
+		t.Errorf("should drop removed records, got: %+v\n", page)
+	}
+}
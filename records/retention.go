@@ -0,0 +1,226 @@
+package records
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const RETENTION_INTERVAL = 10 * time.Minute
+
+// Removal reasons
+const (
+	REASON_AGE          = "age"
+	REASON_CAMERA_QUOTA = "camera_quota"
+	REASON_GLOBAL_QUOTA = "global_quota"
+	REASON_FREE_SPACE   = "free_space"
+)
+
+// Segment is one recorded file of a camera.
+type Segment struct {
+	Camera  string    `json:"camera"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// Policy is disabled in every field that is zero.
+type Policy struct {
+	MaxAge            time.Duration
+	MaxBytesPerCamera int64
+	MaxBytes          int64
+	MinFreeBytes      int64
+}
+
+func (p Policy) Enabled() bool {
+	return p.MaxAge > 0 || p.MaxBytesPerCamera > 0 || p.MaxBytes > 0 || p.MinFreeBytes > 0
+}
+
+type Removal struct {
+	Segment
+	Reason string `json:"reason"`
+}
+
+// Report is sent to local observers and the server after each run.
+type Report struct {
+	At      int64     `json:"at"`
+	Removed []Removal `json:"removed"`
+	Freed   int64     `json:"freed"`
+	Free    int64     `json:"free"`
+	Errors  []string  `json:"errors,omitempty"`
+}
+
+// Scan finds the segments of every camera in recDir, oldest first.
+// A directory in recDir named after a camera holds its segments, a file in
+// recDir belongs to the longest id it starts with. Other directories, files
+// of unknown cameras and hidden files are never returned.
+func Scan(recDir string, ids []string) (map[string][]Segment, error) {
+	entries, err := readDir(recDir)
+	if err != nil {
+		return nil, err
+	}
+	known := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		known[id] = true
+	}
+	segs := make(map[string][]Segment)
+	for _, fi := range entries {
+		if strings.HasPrefix(fi.Name(), ".") {
+			continue
+		}
+		full := filepath.Join(recDir, fi.Name())
+		if fi.IsDir() {
+			id := fi.Name()
+			if !known[id] {
+				continue
+			}
+			filepath.Walk(full, func(path string, info os.FileInfo, err error) error {
+				if err != nil {
+					return nil
+				}
+				if strings.HasPrefix(info.Name(), ".") {
+					if info.IsDir() && path != full {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if info.Mode().IsRegular() {
+					segs[id] = append(segs[id], Segment{id, path, info.Size(), info.ModTime()})
+				}
+				return nil
+			})
+			continue
+		}
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		if id := matchCamera(fi.Name(), ids); id != "" {
+			segs[id] = append(segs[id], Segment{id, full, fi.Size(), fi.ModTime()})
+		}
+	}
+	for _, ss := range segs {
+		sortByAge(ss)
+	}
+	return segs, nil
+}
+
+func readDir(dir string) ([]os.FileInfo, error) {
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return f.Readdir(-1)
+}
+
+// matchCamera returns the longest id that name starts with,
+// followed by a non alphanumeric char.
+func matchCamera(name string, ids []string) string {
+	found := ""
+	for _, id := range ids {
+		if len(id) <= len(found) || !strings.HasPrefix(name, id) {
+			continue
+		}
+		if len(name) > len(id) && isAlnum(name[len(id)]) {
+			continue
+		}
+		found = id
+	}
+	return found
+}
+
+func isAlnum(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func sortByAge(ss []Segment) {
+	sort.SliceStable(ss, func(i, j int) bool { return ss[i].ModTime.Before(ss[j].ModTime) })
+}
+
+// Plan chooses the segments to remove, oldest first within each rule.
+// The newest segment of a camera may still be written, so it is kept.
+// free is the current free space of the filesystem.
+func Plan(segs map[string][]Segment, p Policy, now time.Time, free int64) []Removal {
+	var removals []Removal
+	var candidates []Segment
+	var total int64
+	for _, ss := range segs {
+		if len(ss) == 0 {
+			continue
+		}
+		total += ss[len(ss)-1].Size
+		var kept []Segment
+		var bytes int64
+		for _, s := range ss[:len(ss)-1] {
+			if p.MaxAge > 0 && now.Sub(s.ModTime) > p.MaxAge {
+				removals = append(removals, Removal{s, REASON_AGE})
+				continue
+			}
+			kept = append(kept, s)
+			bytes += s.Size
+		}
+		bytes += ss[len(ss)-1].Size
+		for p.MaxBytesPerCamera > 0 && bytes > p.MaxBytesPerCamera && len(kept) != 0 {
+			removals = append(removals, Removal{kept[0], REASON_CAMERA_QUOTA})
+			bytes -= kept[0].Size
+			kept = kept[1:]
+		}
+		for _, s := range kept {
+			total += s.Size
+		}
+		candidates = append(candidates, kept...)
+	}
+	sortByAge(candidates)
+
+	for p.MaxBytes > 0 && total > p.MaxBytes && len(candidates) != 0 {
+		removals = append(removals, Removal{candidates[0], REASON_GLOBAL_QUOTA})
+		total -= candidates[0].Size
+		candidates = candidates[1:]
+	}
+
+	for _, r := range removals {
+		free += r.Size
+	}
+	for p.MinFreeBytes > 0 && free < p.MinFreeBytes && len(candidates) != 0 {
+		removals = append(removals, Removal{candidates[0], REASON_FREE_SPACE})
+		free += candidates[0].Size
+		candidates = candidates[1:]
+	}
+	return removals
+}
+
+// FreeBytes returns the space available to unprivileged users at dir.
+func FreeBytes(dir string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// Enforce removes the segments chosen by Plan from recDir.
+func Enforce(recDir string, ids []string, p Policy) (*Report, error) {
+	segs, err := Scan(recDir, ids)
+	if err != nil {
+		return nil, err
+	}
+	free, err := FreeBytes(recDir)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	r := &Report{At: now.Unix(), Removed: make([]Removal, 0)}
+	for _, rm := range Plan(segs, p, now, free) {
+		if err := os.Remove(rm.Path); err != nil && !os.IsNotExist(err) {
+			r.Errors = append(r.Errors, err.Error())
+			continue
+		}
+		r.Removed = append(r.Removed, rm)
+		r.Freed += rm.Size
+	}
+	r.Free, _ = FreeBytes(recDir)
+	return r, nil
+}
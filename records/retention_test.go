@@ -0,0 +1,97 @@
+package records
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func seg(camera string, size int64, age time.Duration, now time.Time) Segment {
+	return Segment{Camera: camera, Path: camera + "-" + age.String(), Size: size, ModTime: now.Add(-age)}
+}
+
+func reasons(rs []Removal) map[string]string {
+	m := make(map[string]string)
+	for _, r := range rs {
+		m[r.Path] = r.Reason
+	}
+	return m
+}
+
+func TestPlan(t *testing.T) {
+	now := time.Now()
+	segs := map[string][]Segment{
+		"a": {seg("a", 10, 72*time.Hour, now), seg("a", 10, 3*time.Hour, now), seg("a", 10, 2*time.Hour, now), seg("a", 10, time.Hour, now)},
+		// only the newest segment, never removed
+		"b": {seg("b", 100, 96*time.Hour, now)},
+		"c": {seg("c", 10, 5*time.Hour, now), seg("c", 10, 4*time.Hour, now)},
+	}
+
+	rs := reasons(Plan(segs, Policy{MaxAge: 48 * time.Hour}, now, 1000))
+	if len(rs) != 1 || rs["a-72h0m0s"] != REASON_AGE {
+		t.Errorf("should remove old segments except the newest, got: %v\n", rs)
+	}
+
+	rs = reasons(Plan(segs, Policy{MaxBytesPerCamera: 25}, now, 1000))
+	if len(rs) != 2 || rs["a-72h0m0s"] != REASON_CAMERA_QUOTA || rs["a-3h0m0s"] != REASON_CAMERA_QUOTA {
+		t.Errorf("should remove the oldest of camera over quota, got: %v\n", rs)
+	}
+
+	// total 160
+	rs = reasons(Plan(segs, Policy{MaxBytes: 135}, now, 1000))
+	if len(rs) != 3 || rs["a-72h0m0s"] != REASON_GLOBAL_QUOTA || rs["c-5h0m0s"] != REASON_GLOBAL_QUOTA || rs["a-3h0m0s"] != REASON_GLOBAL_QUOTA {
+		t.Errorf("should remove the oldest of all cameras, got: %v\n", rs)
+	}
+
+	rs = reasons(Plan(segs, Policy{MaxAge: 48 * time.Hour, MinFreeBytes: 115}, now, 95))
+	if len(rs) != 2 || rs["a-72h0m0s"] != REASON_AGE || rs["c-5h0m0s"] != REASON_FREE_SPACE {
+		t.Errorf("should count removed bytes as free, got: %v\n", rs)
+	}
+
+	if rs := Plan(segs, Policy{}, now, 0); len(rs) != 0 {
+		t.Errorf("empty policy should remove nothing, got: %v\n", rs)
+	}
+}
+
+func TestScan(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ic-client-one-records-")
+	defer os.RemoveAll(dir)
+
+	os.MkdirAll(filepath.Join(dir, "cam1", "2016"), 0755)
+	os.MkdirAll(filepath.Join(dir, "backup"), 0755)
+	files := []string{"backup/db.snap", "cam1/2016/a.mkv", "cam1/b.mkv", "cam1/.tmp", "cam10-1.mkv", "cam1_2.mkv", "camx.mkv", "cam10"}
+	for i, f := range files {
+		name := filepath.Join(dir, f)
+		ioutil.WriteFile(name, []byte("data"), 0644)
+		mt := time.Now().Add(time.Duration(i-len(files)) * time.Hour)
+		os.Chtimes(name, mt, mt)
+	}
+
+	segs, err := Scan(dir, []string{"cam1", "cam10"})
+	if err != nil {
+		t.Fatalf("Scan err: %v\n", err)
+	}
+	if len(segs["cam1"]) != 3 || len(segs["cam10"]) != 2 || len(segs) != 2 {
+		t.Errorf("should group by camera, got: %v\n", segs)
+	}
+	if filepath.Base(segs["cam1"][0].Path) != "a.mkv" || filepath.Base(segs["cam1"][2].Path) != "cam1_2.mkv" {
+		t.Errorf("should sort oldest first, got: %v\n", segs["cam1"])
+	}
+
+	r, err := Enforce(dir, []string{"cam1", "cam10"}, Policy{MaxBytesPerCamera: 4})
+	if err != nil || len(r.Removed) != 3 || r.Freed != 12 {
+		t.Errorf("Enforce should remove all but the newest, got: %v, err: %v\n", r, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "cam1_2.mkv")); err != nil {
+		t.Errorf("should keep the newest segment\n")
+	}
+
+	if r, _ := Enforce(dir, []string{"cam1", "cam10"}, Policy{MaxBytes: 1}); len(r.Removed) != 0 {
+		t.Errorf("should not remove files of other directories, got: %v\n", r.Removed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "backup", "db.snap")); err != nil {
+		t.Errorf("should keep files of other directories\n")
+	}
+}
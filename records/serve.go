@@ -0,0 +1,142 @@
+package records
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const BASIC_REALM = `Basic realm="ic-client records"`
+
+// segment types mime does not always know
+var contentTypes = map[string]string{
+	".mkv":  "video/x-matroska",
+	".mp4":  "video/mp4",
+	".ts":   "video/mp2t",
+	".flv":  "video/x-flv",
+	".webm": "video/webm",
+	".h264": "video/h264",
+}
+
+// FileServer lists and streams segments in RecDir to LAN browsers.
+type FileServer struct {
+	Dir      string
+	Index    *Index
+	User     string
+	Password string
+}
+
+func (s *FileServer) authorized(r *http.Request) bool {
+	user, pass, ok := r.BasicAuth()
+	if !ok || s.User == "" {
+		return false
+	}
+	okUser := subtle.ConstantTimeCompare([]byte(user), []byte(s.User)) == 1
+	okPass := subtle.ConstantTimeCompare([]byte(pass), []byte(s.Password)) == 1
+	return okUser && okPass
+}
+
+// Serve lists the records of camera when file is empty or "/",
+// otherwise streams the file with Range support.
+func (s *FileServer) Serve(w http.ResponseWriter, r *http.Request, camera, file string) {
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", BASIC_REALM)
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !validName(camera) {
+		http.NotFound(w, r)
+		return
+	}
+	if file == "" || file == "/" {
+		s.serveList(w, r, camera)
+		return
+	}
+
+	full, ok := s.resolve(camera, file)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(full)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	if t := ContentType(full); t != "" {
+		w.Header().Set("Content-Type", t)
+	}
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
+
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.HasPrefix(name, ".") &&
+		!strings.ContainsAny(name, `/\`)
+}
+
+// resolve keeps the file inside RecDir/camera, after following symlinks too.
+// Files of the prefix layout, RecDir/<camera>..., are found by the indexed Path.
+func (s *FileServer) resolve(camera, file string) (string, bool) {
+	clean := path.Clean("/" + file)
+	for _, elem := range strings.Split(clean, "/")[1:] {
+		if strings.HasPrefix(elem, ".") {
+			return "", false
+		}
+	}
+	if full, ok := within(filepath.Join(s.Dir, camera), clean); ok {
+		return full, true
+	}
+	if r, ok := s.Index.Lookup(clean[1:]); ok && r.Camera == camera {
+		return within(s.Dir, r.Path)
+	}
+	return "", false
+}
+
+func within(dir, file string) (string, bool) {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", false
+	}
+	full, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(file)))
+	if err != nil {
+		return "", false
+	}
+	rel, err := filepath.Rel(root, full)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return full, true
+}
+
+func ContentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+	return mime.TypeByExtension(ext)
+}
+
+// serveList accepts from, to, offset and limit like Query.
+func (s *FileServer) serveList(w http.ResponseWriter, r *http.Request, camera string) {
+	v := r.URL.Query()
+	q := Query{Camera: camera}
+	q.From, _ = strconv.ParseInt(v.Get("from"), 10, 64)
+	q.To, _ = strconv.ParseInt(v.Get("to"), 10, 64)
+	q.Offset, _ = strconv.Atoi(v.Get("offset"))
+	q.Limit, _ = strconv.Atoi(v.Get("limit"))
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(s.Index.List(q))
+}
@@ -0,0 +1,78 @@
+package records
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileServer(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ic-client-one-serve-")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(filepath.Join(dir, "cam1"), 0755)
+	ioutil.WriteFile(filepath.Join(dir, "cam1", "a.mkv"), []byte("0123456789"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "cam1_20160102.mkv"), []byte("prefix"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "cam2_20160102.mkv"), []byte("other"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0644)
+	os.Symlink(filepath.Join(dir, "secret"), filepath.Join(dir, "cam1", "link.mkv"))
+
+	x := NewIndex(dir)
+	x.Update([]string{"cam1", "cam2"})
+	s := &FileServer{Dir: dir, Index: x, User: "u", Password: "p"}
+
+	get := func(camera, file string, auth bool, header ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/records/"+camera+file, nil)
+		if auth {
+			r.SetBasicAuth("u", "p")
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			r.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		s.Serve(w, r, camera, file)
+		return w
+	}
+
+	if w := get("cam1", "/a.mkv", false); w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("should ask for auth, got: %d\n", w.Code)
+	}
+
+	w := get("cam1", "/a.mkv", true)
+	if w.Code != http.StatusOK || w.Body.String() != "0123456789" || w.Header().Get("Content-Type") != "video/x-matroska" {
+		t.Errorf("should stream file, got: %d %q %s\n", w.Code, w.Body.String(), w.Header().Get("Content-Type"))
+	}
+
+	w = get("cam1", "/a.mkv", true, "Range", "bytes=2-5")
+	if w.Code != http.StatusPartialContent || w.Body.String() != "2345" || w.Header().Get("Content-Range") != "bytes 2-5/10" {
+		t.Errorf("should serve range, got: %d %q\n", w.Code, w.Body.String())
+	}
+
+	w = get("cam1", "/cam1_20160102.mkv", true)
+	if w.Code != http.StatusOK || w.Body.String() != "prefix" {
+		t.Errorf("should stream file of prefix layout, got: %d %q\n", w.Code, w.Body.String())
+	}
+
+	for _, c := range [][2]string{{"cam1", "/../secret"}, {"..", "/secret"}, {"cam1", "/link.mkv"}, {"cam1", "/.hidden"}, {"cam1", "/none.mkv"},
+		{"cam1", "/secret"}, {"cam1", "/cam2_20160102.mkv"}, {"cam2", "/../cam1_20160102.mkv"}} {
+		if w := get(c[0], c[1], true); w.Code != http.StatusNotFound {
+			t.Errorf("should not serve %s%s, got: %d %q\n", c[0], c[1], w.Code, w.Body.String())
+		}
+	}
+
+	w = get("cam1", "/", true)
+	var page Page
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil || page.Total != 2 || page.Records[0].Camera != "cam1" {
+		t.Errorf("should list records of camera, got: %s\n", w.Body.String())
+	}
+	for _, r := range page.Records {
+		file := strings.TrimPrefix(r.Path, "cam1/")
+		if w := get("cam1", "/"+file, true); w.Code != http.StatusOK {
+			t.Errorf("should stream listed %s, got: %d\n", r.Path, w.Code)
+		}
+	}
+}
@@ -0,0 +1,330 @@
+package rtsp
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_PORT  = "554"
+	PROBE_TIMEOUT = 5 * time.Second
+	maxBody       = 64 * 1024
+	userAgent     = "ic-client-one"
+)
+
+// why a probe failed, empty when it did not
+const (
+	REASON_BAD_URL      = "BadUrl"
+	REASON_UNREACHABLE  = "Unreachable"
+	REASON_TIMEOUT      = "Timeout"
+	REASON_NOT_RTSP     = "NotRtsp"
+	REASON_UNAUTHORIZED = "Unauthorized"
+	REASON_NOT_FOUND    = "NotFound"
+	REASON_REJECTED     = "Rejected"
+	REASON_NO_VIDEO     = "NoVideo"
+)
+
+type ProbeError struct {
+	Reason string
+	// rtsp status code, 0 if no response
+	Status int
+	Err    error
+}
+
+func (e *ProbeError) Error() string {
+	switch {
+	case e.Err != nil:
+		return fmt.Sprintf("rtsp %s: %v", e.Reason, e.Err)
+	case e.Status != 0:
+		return fmt.Sprintf("rtsp %s: status %d", e.Reason, e.Status)
+	}
+	return "rtsp " + e.Reason
+}
+
+// Reason classifies err returned by Probe.
+func Reason(err error) string {
+	if err == nil {
+		return ""
+	}
+	if pe, ok := err.(*ProbeError); ok {
+		return pe.Reason
+	}
+	return REASON_UNREACHABLE
+}
+
+// Result is what DESCRIBE tells about the stream.
+type Result struct {
+	Server string `json:"server,omitempty"`
+	// like "video H264", "audio PCMA"
+	Media []string `json:"media"`
+}
+
+// Probe sends OPTIONS and DESCRIBE to rawurl, authenticating with the user
+// info of rawurl when asked, digest or basic.
+func Probe(rawurl string, timeout time.Duration) (*Result, error) {
+	if timeout <= 0 {
+		timeout = PROBE_TIMEOUT
+	}
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "rtsp" || u.Host == "" {
+		if err == nil {
+			err = fmt.Errorf("not a rtsp url")
+		}
+		return nil, &ProbeError{Reason: REASON_BAD_URL, Err: err}
+	}
+	addr := u.Host
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(strings.Trim(addr, "[]"), DEFAULT_PORT)
+	}
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, &ProbeError{Reason: REASON_UNREACHABLE, Err: err}
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c := &client{
+		conn: conn,
+		r:    textproto.NewReader(bufio.NewReader(conn)),
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	u.User = nil
+	uri := u.String()
+
+	res, err := c.request("OPTIONS", uri)
+	if err != nil {
+		return nil, err
+	}
+	res, err = c.request("DESCRIBE", uri, "Accept: application/sdp")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case res.status == 200:
+	case res.status == 404:
+		return nil, &ProbeError{Reason: REASON_NOT_FOUND, Status: res.status}
+	default:
+		return nil, &ProbeError{Reason: REASON_REJECTED, Status: res.status}
+	}
+
+	r := &Result{Server: res.header.Get("Server"), Media: sdpMedia(res.body)}
+	for _, m := range r.Media {
+		if strings.HasPrefix(m, "video") {
+			return r, nil
+		}
+	}
+	return r, &ProbeError{Reason: REASON_NO_VIDEO}
+}
+
+type response struct {
+	status int
+	header textproto.MIMEHeader
+	body   string
+}
+
+type client struct {
+	conn     net.Conn
+	r        *textproto.Reader
+	cseq     int
+	user     string
+	password string
+	// builds Authorization for method and uri, nil before asked
+	auth func(method, uri string) string
+}
+
+// request authenticates once more when the server asks to, a nonce may be
+// stale.
+func (c *client) request(method, uri string, headers ...string) (*response, error) {
+	res, err := c.do(method, uri, headers)
+	if err != nil || res.status != 401 {
+		return res, err
+	}
+	if c.user != "" {
+		c.auth = c.authorizer(res.header["Www-Authenticate"])
+	}
+	if c.auth != nil {
+		if res, err = c.do(method, uri, headers); err != nil || res.status != 401 {
+			return res, err
+		}
+	}
+	return nil, &ProbeError{Reason: REASON_UNAUTHORIZED, Status: res.status}
+}
+
+func (c *client) do(method, uri string, headers []string) (*response, error) {
+	c.cseq++
+	req := fmt.Sprintf("%s %s RTSP/1.0\r\nCSeq: %d\r\nUser-Agent: %s\r\n", method, uri, c.cseq, userAgent)
+	if c.auth != nil {
+		req += "Authorization: " + c.auth(method, uri) + "\r\n"
+	}
+	for _, h := range headers {
+		req += h + "\r\n"
+	}
+	if _, err := io.WriteString(c.conn, req+"\r\n"); err != nil {
+		return nil, netError(err)
+	}
+
+	line, err := c.r.ReadLine()
+	if err != nil {
+		return nil, netError(err)
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "RTSP/") {
+		return nil, &ProbeError{Reason: REASON_NOT_RTSP, Err: fmt.Errorf("bad status line %q", line)}
+	}
+	res := &response{}
+	if res.status, err = strconv.Atoi(parts[1]); err != nil {
+		return nil, &ProbeError{Reason: REASON_NOT_RTSP, Err: err}
+	}
+	if res.header, err = c.r.ReadMIMEHeader(); err != nil && err != io.EOF {
+		return nil, netError(err)
+	}
+	if n, _ := strconv.Atoi(res.header.Get("Content-Length")); n > 0 {
+		if n > maxBody {
+			return nil, &ProbeError{Reason: REASON_NOT_RTSP, Err: fmt.Errorf("body too large: %d", n)}
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(c.r.R, body); err != nil {
+			return nil, netError(err)
+		}
+		res.body = string(body)
+	}
+	return res, nil
+}
+
+func netError(err error) error {
+	if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		return &ProbeError{Reason: REASON_TIMEOUT, Err: err}
+	}
+	return &ProbeError{Reason: REASON_UNREACHABLE, Err: err}
+}
+
+// authorizer prefers digest, nil for unknown schemes.
+func (c *client) authorizer(challenges []string) func(method, uri string) string {
+	for _, ch := range challenges {
+		if scheme, params := parseChallenge(ch); strings.EqualFold(scheme, "Digest") {
+			return c.digest(params)
+		}
+	}
+	for _, ch := range challenges {
+		if scheme, _ := parseChallenge(ch); strings.EqualFold(scheme, "Basic") {
+			basic := "Basic " + base64.StdEncoding.EncodeToString([]byte(c.user+":"+c.password))
+			return func(string, string) string { return basic }
+		}
+	}
+	return nil
+}
+
+func md5hex(s string) string { return fmt.Sprintf("%x", md5.Sum([]byte(s))) }
+
+func newCnonce() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+// digest answers qop=auth when offered, RFC 2617, otherwise RFC 2069.
+func (c *client) digest(params map[string]string) func(method, uri string) string {
+	realm, nonce, opaque := params["realm"], params["nonce"], params["opaque"]
+	ha1 := md5hex(c.user + ":" + realm + ":" + c.password)
+	qop := false
+	for _, q := range strings.Split(params["qop"], ",") {
+		qop = qop || strings.TrimSpace(q) == "auth"
+	}
+	nc := 0
+	return func(method, uri string) string {
+		ha2 := md5hex(method + ":" + uri)
+		response := md5hex(ha1 + ":" + nonce + ":" + ha2)
+		var auth string
+		if qop {
+			nc++
+			cnonce := newCnonce()
+			response = md5hex(fmt.Sprintf("%s:%s:%08x:%s:auth:%s", ha1, nonce, nc, cnonce, ha2))
+			auth = fmt.Sprintf(`, qop=auth, nc=%08x, cnonce="%s"`, nc, cnonce)
+		}
+		h := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+			c.user, realm, nonce, uri, response) + auth
+		if opaque != "" {
+			h += `, opaque="` + opaque + `"`
+		}
+		return h
+	}
+}
+
+// parseChallenge parses `Digest realm="a, b", nonce="n"`.
+func parseChallenge(ch string) (scheme string, params map[string]string) {
+	ch = strings.TrimSpace(ch)
+	i := strings.IndexByte(ch, ' ')
+	if i < 0 {
+		return ch, nil
+	}
+	scheme, rest := ch[:i], ch[i+1:]
+	params = make(map[string]string)
+	for {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			return scheme, params
+		}
+		k := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var v string
+		if strings.HasPrefix(rest, `"`) {
+			if end := strings.IndexByte(rest[1:], '"'); end >= 0 {
+				v, rest = rest[1:end+1], rest[end+2:]
+			} else {
+				v, rest = rest[1:], ""
+			}
+		} else if end := strings.IndexByte(rest, ','); end >= 0 {
+			v, rest = rest[:end], rest[end:]
+		} else {
+			v, rest = rest, ""
+		}
+		params[k] = strings.TrimSpace(v)
+	}
+}
+
+// sdpMedia lists the media of sdp with their codec when known.
+func sdpMedia(sdp string) []string {
+	var media []string
+	// index of media by payload type, per media section
+	var payloads map[string]int
+	for _, line := range strings.Split(sdp, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m="):
+			fs := strings.Fields(line[2:])
+			if len(fs) == 0 {
+				continue
+			}
+			media = append(media, fs[0])
+			payloads = make(map[string]int)
+			if len(fs) > 3 {
+				for _, pt := range fs[3:] {
+					payloads[pt] = len(media) - 1
+				}
+			}
+		case strings.HasPrefix(line, "a=rtpmap:") && payloads != nil:
+			fs := strings.Fields(line[len("a=rtpmap:"):])
+			if len(fs) != 2 {
+				continue
+			}
+			if k, ok := payloads[fs[0]]; ok && !strings.Contains(media[k], " ") {
+				media[k] += " " + strings.SplitN(fs[1], "/", 2)[0]
+			}
+		}
+	}
+	return media
+}
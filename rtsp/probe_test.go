@@ -0,0 +1,156 @@
+package rtsp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	stubRealm = "IP Camera, 1"
+	stubNonce = "0a4f113b"
+)
+
+const stubSdp = "v=0\r\no=- 0 0 IN IP4 127.0.0.1\r\ns=Media\r\n" +
+	"m=video 0 RTP/AVP 96\r\na=rtpmap:96 H264/90000\r\n" +
+	"m=audio 0 RTP/AVP 8\r\na=rtpmap:8 PCMA/8000\r\n"
+
+// serveStub answers like a camera, the path of the url picks the behaviour.
+func serveStub(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	r := textproto.NewReader(bufio.NewReader(conn))
+	lastNc := int64(0)
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			return
+		}
+		h, err := r.ReadMIMEHeader()
+		if err != nil {
+			return
+		}
+		fs := strings.Fields(line)
+		method, path := fs[0], fs[1][strings.LastIndex(fs[1], "/"):]
+		reply := func(status string, headers ...string) {
+			body := ""
+			if method == "DESCRIBE" && strings.HasPrefix(status, "200") {
+				body = stubSdp
+				if path == "/audio" {
+					body = stubSdp[:strings.Index(stubSdp, "m=video")] + stubSdp[strings.Index(stubSdp, "m=audio"):]
+				}
+				headers = append(headers, fmt.Sprintf("Content-Length: %d", len(body)))
+			}
+			fmt.Fprintf(conn, "RTSP/1.0 %s\r\nCSeq: %s\r\nServer: stub\r\n%s\r\n%s",
+				status, h.Get("CSeq"), strings.Join(append(headers, ""), "\r\n"), body)
+		}
+
+		switch path {
+		case "/http":
+			fmt.Fprint(conn, "HTTP/1.1 400 Bad Request\r\n\r\n")
+			return
+		case "/slow":
+			time.Sleep(time.Second)
+			return
+		case "/missing":
+			if method == "DESCRIBE" {
+				reply("404 Not Found")
+				continue
+			}
+		case "/basic":
+			if h.Get("Authorization") != "Basic YWRtaW46c2VjcmV0" {
+				reply("401 Unauthorized", `WWW-Authenticate: Basic realm="cam"`)
+				continue
+			}
+		case "/qop":
+			_, params := parseChallenge(h.Get("Authorization"))
+			nc, _ := strconv.ParseInt(params["nc"], 16, 64)
+			want := md5hex(md5hex("admin:"+stubRealm+":secret") + ":" + stubNonce + ":" + params["nc"] + ":" +
+				params["cnonce"] + ":auth:" + md5hex(method+":"+fs[1]))
+			if params["qop"] != "auth" || nc <= lastNc || params["cnonce"] == "" || params["response"] != want {
+				reply("401 Unauthorized",
+					fmt.Sprintf(`WWW-Authenticate: Digest realm="%s", nonce="%s", qop="auth,auth-int"`, stubRealm, stubNonce))
+				continue
+			}
+			lastNc = nc
+		default:
+			uri := fs[1]
+			want := fmt.Sprintf(`Digest username="admin", realm="%s", nonce="%s", uri="%s", response="%s"`,
+				stubRealm, stubNonce, uri,
+				md5hex(md5hex("admin:"+stubRealm+":secret")+":"+stubNonce+":"+md5hex(method+":"+uri)))
+			if h.Get("Authorization") != want {
+				reply("401 Unauthorized", `WWW-Authenticate: Basic realm="cam"`,
+					fmt.Sprintf(`WWW-Authenticate: Digest realm="%s", nonce="%s", stale=FALSE`, stubRealm, stubNonce))
+				continue
+			}
+		}
+		reply("200 OK", "Public: OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN")
+	}
+}
+
+func listenStub(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen tcp:", err)
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveStub(t, conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestProbe(t *testing.T) {
+	addr := listenStub(t)
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	cases := []struct {
+		url    string
+		reason string
+	}{
+		{"rtsp://admin:secret@" + addr + "/h264/ch1", ""},
+		{"rtsp://admin:secret@" + addr + "/basic", ""},
+		{"rtsp://admin:secret@" + addr + "/qop", ""},
+		{"rtsp://admin:wrong@" + addr + "/qop", REASON_UNAUTHORIZED},
+		{"rtsp://admin:wrong@" + addr + "/h264/ch1", REASON_UNAUTHORIZED},
+		{"rtsp://" + addr + "/h264/ch1", REASON_UNAUTHORIZED},
+		{"rtsp://admin:wrong@" + addr + "/basic", REASON_UNAUTHORIZED},
+		{"rtsp://" + addr + "/missing", REASON_NOT_FOUND},
+		{"rtsp://admin:secret@" + addr + "/audio", REASON_NO_VIDEO},
+		{"rtsp://" + addr + "/http", REASON_NOT_RTSP},
+		{"rtsp://" + addr + "/slow", REASON_TIMEOUT},
+		{"rtsp://" + closedAddr + "/h264/ch1", REASON_UNREACHABLE},
+		{"http://" + addr + "/h264/ch1", REASON_BAD_URL},
+	}
+	for _, c := range cases {
+		_, err := Probe(c.url, 300*time.Millisecond)
+		if r := Reason(err); r != c.reason {
+			t.Errorf("%s should get reason %q, got: %q, err: %v\n", c.url, c.reason, r, err)
+		}
+	}
+
+	r, err := Probe("rtsp://admin:secret@"+addr+"/h264/ch1", time.Second)
+	if err != nil || r.Server != "stub" || !reflect.DeepEqual(r.Media, []string{"video H264", "audio PCMA"}) {
+		t.Errorf("should describe the stream, got: %+v, err: %v\n", r, err)
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Digest realm="IP Camera, 1", nonce="abc", algorithm=MD5, stale=FALSE`)
+	want := map[string]string{"realm": "IP Camera, 1", "nonce": "abc", "algorithm": "MD5", "stale": "FALSE"}
+	if scheme != "Digest" || !reflect.DeepEqual(params, want) {
+		t.Errorf("unexpected challenge: %s %v\n", scheme, params)
+	}
+}
@@ -0,0 +1,154 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const CLOCK_LAYOUT = "15:04"
+
+var (
+	ErrCameraRequired = errors.New("schedule camera required")
+	ErrWindowDay      = errors.New("window day must be 0 (Sunday) to 6")
+	ErrWindowEmpty    = errors.New("window start and end must differ")
+)
+
+// Window records from Start to End on Day, in the schedule's timezone.
+// End not after Start means the window ends on the next day.
+// A clock skipped by DST moves forward with the offset, a repeated clock
+// is its first occurrence.
+type Window struct {
+	Day   time.Weekday `json:"day"`
+	Start string       `json:"start"`
+	End   string       `json:"end"`
+}
+
+// Schedule turns recording of Camera on inside any of Windows,
+// and off outside of them.
+type Schedule struct {
+	Camera string `json:"camera"`
+	// IANA name like "Asia/Shanghai", empty is the local timezone
+	Location string   `json:"location,omitempty"`
+	Windows  []Window `json:"windows"`
+	Disabled bool     `json:"disabled,omitempty"`
+}
+
+type Schedules map[string]Schedule
+
+func parseClock(s string) (h, m int, err error) {
+	// "24:00" ends a window at midnight
+	if s == "24:00" {
+		return 24, 0, nil
+	}
+	t, err := time.Parse(CLOCK_LAYOUT, s)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad clock %q, want HH:MM", s)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+func (w *Window) clocks() (sh, sm, eh, em int, err error) {
+	if w.Day < time.Sunday || w.Day > time.Saturday {
+		return 0, 0, 0, 0, ErrWindowDay
+	}
+	if sh, sm, err = parseClock(w.Start); err != nil {
+		return
+	}
+	if eh, em, err = parseClock(w.End); err != nil {
+		return
+	}
+	if sh == 24 {
+		err = fmt.Errorf("bad clock %q, want HH:MM", w.Start)
+	} else if sh*60+sm == eh*60+em {
+		err = ErrWindowEmpty
+	}
+	return
+}
+
+// bounds returns the window on the week of the given date.
+// time.Date normalizes clocks skipped or repeated by DST.
+func (w *Window) bounds(y int, mon time.Month, d int, loc *time.Location) (start, end time.Time) {
+	sh, sm, eh, em, _ := w.clocks()
+	start = time.Date(y, mon, d, sh, sm, 0, 0, loc)
+	if eh*60+em <= sh*60+sm {
+		d++
+	}
+	end = time.Date(y, mon, d, eh, em, 0, 0, loc)
+	return start, end
+}
+
+func (s *Schedule) location() (*time.Location, error) {
+	if s.Location == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(s.Location)
+}
+
+func (s *Schedule) Validate() error {
+	if s.Camera == "" {
+		return ErrCameraRequired
+	}
+	if _, err := s.location(); err != nil {
+		return err
+	}
+	for i := range s.Windows {
+		if _, _, _, _, err := s.Windows[i].clocks(); err != nil {
+			return fmt.Errorf("windows[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// each calls fn with every window that may touch the days around t.
+func (s *Schedule) each(t time.Time, days int, fn func(start, end time.Time) bool) {
+	loc, err := s.location()
+	if err != nil {
+		return
+	}
+	lt := t.In(loc)
+	y, mon, d := lt.Date()
+	// from the day before, windows may cross midnight
+	for n := -1; n < days; n++ {
+		day := time.Date(y, mon, d+n, 12, 0, 0, 0, loc)
+		for i := range s.Windows {
+			if s.Windows[i].Day != day.Weekday() {
+				continue
+			}
+			start, end := s.Windows[i].bounds(day.Year(), day.Month(), day.Day(), loc)
+			if !fn(start, end) {
+				return
+			}
+		}
+	}
+}
+
+// On tells if recording should be on at t.
+func (s *Schedule) On(t time.Time) bool {
+	if s.Disabled {
+		return false
+	}
+	on := false
+	s.each(t, 1, func(start, end time.Time) bool {
+		on = !t.Before(start) && t.Before(end)
+		return !on
+	})
+	return on
+}
+
+// Next returns the first window edge after t, false when there is none.
+func (s *Schedule) Next(t time.Time) (time.Time, bool) {
+	var next time.Time
+	if s.Disabled {
+		return next, false
+	}
+	s.each(t, 8, func(start, end time.Time) bool {
+		for _, edge := range []time.Time{start, end} {
+			if edge.After(t) && (next.IsZero() || edge.Before(next)) {
+				next = edge
+			}
+		}
+		return true
+	})
+	return next, !next.IsZero()
+}
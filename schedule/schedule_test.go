@@ -0,0 +1,110 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skip("no tzdata:", err)
+	}
+	return loc
+}
+
+func TestSchedule_Validate(t *testing.T) {
+	s := Schedule{Camera: "a", Windows: []Window{{Day: time.Monday, Start: "08:00", End: "24:00"}}}
+	if err := s.Validate(); err != nil {
+		t.Errorf("should be valid, err: %v\n", err)
+	}
+	for _, w := range []Window{
+		{Day: 7, Start: "08:00", End: "09:00"},
+		{Day: time.Monday, Start: "8", End: "09:00"},
+		{Day: time.Monday, Start: "24:00", End: "09:00"},
+		{Day: time.Monday, Start: "09:00", End: "09:00"},
+	} {
+		s.Windows = []Window{w}
+		if err := s.Validate(); err == nil {
+			t.Errorf("should reject %+v\n", w)
+		}
+	}
+	s = Schedule{Camera: "a", Location: "No/Where"}
+	if err := s.Validate(); err == nil {
+		t.Errorf("should reject unknown location\n")
+	}
+}
+
+func TestSchedule_OnNext(t *testing.T) {
+	loc := mustLoad(t, "Asia/Shanghai")
+	s := Schedule{Camera: "a", Location: "Asia/Shanghai", Windows: []Window{
+		{Day: time.Friday, Start: "22:00", End: "06:00"},
+		{Day: time.Monday, Start: "08:00", End: "18:00"},
+	}}
+	// 2026-10-16 is a Friday
+	cases := []struct {
+		at time.Time
+		on bool
+	}{
+		{time.Date(2026, 10, 16, 21, 59, 0, 0, loc), false},
+		{time.Date(2026, 10, 16, 22, 0, 0, 0, loc), true},
+		{time.Date(2026, 10, 17, 5, 59, 0, 0, loc), true},
+		{time.Date(2026, 10, 17, 6, 0, 0, 0, loc), false},
+		{time.Date(2026, 10, 19, 12, 0, 0, 0, loc), true},
+		// the same instant in another timezone
+		{time.Date(2026, 10, 19, 4, 0, 0, 0, time.UTC), true},
+	}
+	for _, c := range cases {
+		if on := s.On(c.at); on != c.on {
+			t.Errorf("On(%v) should be %v\n", c.at, c.on)
+		}
+	}
+
+	next, ok := s.Next(time.Date(2026, 10, 17, 7, 0, 0, 0, loc))
+	if want := time.Date(2026, 10, 19, 8, 0, 0, 0, loc); !ok || !next.Equal(want) {
+		t.Errorf("Next should be %v, got: %v\n", want, next)
+	}
+	next, _ = s.Next(time.Date(2026, 10, 16, 22, 0, 0, 0, loc))
+	if want := time.Date(2026, 10, 17, 6, 0, 0, 0, loc); !next.Equal(want) {
+		t.Errorf("Next should be the end %v, got: %v\n", want, next)
+	}
+
+	s.Disabled = true
+	if _, ok := s.Next(time.Now()); ok || s.On(time.Date(2026, 10, 19, 12, 0, 0, 0, loc)) {
+		t.Errorf("disabled schedule should never record\n")
+	}
+	if _, ok := (&Schedule{Camera: "a"}).Next(time.Now()); ok {
+		t.Errorf("no windows should have no edge\n")
+	}
+}
+
+func TestSchedule_DST(t *testing.T) {
+	loc := mustLoad(t, "America/New_York")
+	// 2026-03-08 02:00 does not exist
+	s := Schedule{Camera: "a", Location: "America/New_York", Windows: []Window{
+		{Day: time.Sunday, Start: "01:00", End: "03:30"},
+	}}
+
+	spring := time.Date(2026, 3, 8, 6, 0, 0, 0, time.UTC) // 01:00 EST
+	if !s.On(spring) || !s.On(spring.Add(89*time.Minute)) || s.On(spring.Add(-time.Minute)) {
+		t.Errorf("should record across the skipped hour\n")
+	}
+	next, _ := s.Next(spring)
+	if d := next.Sub(spring); d != 90*time.Minute {
+		t.Errorf("window should last 1.5h on spring forward, got: %v\n", d)
+	}
+
+	// 2026-11-01 01:00-02:00 happens twice
+	s.Windows = []Window{{Day: time.Sunday, Start: "00:30", End: "01:30"}}
+	fall := time.Date(2026, 11, 1, 0, 30, 0, 0, loc)
+	next, _ = s.Next(fall)
+	if d := next.Sub(fall); d != time.Hour {
+		t.Errorf("window should end at the first 01:30, got: %v\n", d)
+	}
+	if !s.On(fall.Add(59*time.Minute)) || s.On(fall.Add(61*time.Minute)) {
+		t.Errorf("should not record the repeated hour again\n")
+	}
+	if s.On(time.Date(2026, 11, 1, 3, 0, 0, 0, loc)) {
+		t.Errorf("should stop after the window\n")
+	}
+}
@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/boltdb/bolt"
+	. "github.com/empirefox/ic-client-one/ipcam"
+	"github.com/golang/glog"
+)
+
+const (
+	BACKUP_PREFIX      = "ic-room-"
+	BACKUP_SUFFIX      = ".db"
+	// nanoseconds, backups in the same second must not replace each other
+	BACKUP_TIME_LAYOUT = "20060102-150405.000000000"
+	BACKUP_KEEP        = 7
+)
+
+var (
+	ErrBackupDirRequired = errors.New("BackupDir must be set")
+	ErrNoSnapshot        = errors.New("no snapshot found")
+	ErrDbInUse           = errors.New("database is in use, stop the client first")
+	ErrSnapshotNoSystem  = errors.New("snapshot has no system bucket")
+	ErrSnapshotNoIpcams  = errors.New("snapshot has no ipcams bucket")
+	ErrSnapshotTooNew    = errors.New("snapshot schema is newer than this client")
+	ErrDbNotOpen         = errors.New("database is not open")
+)
+
+func (c *Conf) GetBackupInterval() time.Duration {
+	if c.setup.BackupDir == "" {
+		return 0
+	}
+	return c.setup.BackupSecond * time.Second
+}
+
+// Backup writes a consistent snapshot of the open database into BackupDir,
+// then removes the oldest snapshots over BackupKeep.
+func (c *Conf) Backup() (string, error) {
+	if c.setup.BackupDir == "" {
+		return "", ErrBackupDirRequired
+	}
+	if c.db == nil {
+		return "", ErrDbNotOpen
+	}
+	if err := os.MkdirAll(c.setup.BackupDir, 0755); err != nil {
+		return "", err
+	}
+	name := filepath.Join(c.setup.BackupDir, BACKUP_PREFIX+time.Now().Format(BACKUP_TIME_LAYOUT)+BACKUP_SUFFIX)
+	tmp := name + ".tmp"
+
+	err := c.db.View(func(tx *bolt.Tx) error {
+		f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, FILE_MODE)
+		if err != nil {
+			return err
+		}
+		if _, err = tx.WriteTo(f); err != nil {
+			f.Close()
+			return err
+		}
+		if err = f.Sync(); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	})
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		glog.Errorln(err)
+		return "", err
+	}
+
+	c.rotateBackups()
+	return name, nil
+}
+
+func (c *Conf) rotateBackups() {
+	keep := c.setup.BackupKeep
+	if keep <= 0 {
+		keep = BACKUP_KEEP
+	}
+	snapshots, err := c.Snapshots()
+	if err != nil {
+		glog.Errorln(err)
+		return
+	}
+	for len(snapshots) > keep {
+		if err := os.Remove(snapshots[0]); err != nil {
+			glog.Errorln(err)
+		}
+		snapshots = snapshots[1:]
+	}
+}
+
+// Snapshots lists the snapshots in BackupDir, oldest first.
+func (c *Conf) Snapshots() ([]string, error) {
+	if c.setup.BackupDir == "" {
+		return nil, ErrBackupDirRequired
+	}
+	files, err := filepath.Glob(filepath.Join(c.setup.BackupDir, BACKUP_PREFIX+"*"+BACKUP_SUFFIX))
+	if err != nil {
+		return nil, err
+	}
+	// names embed the time, so lexical order is time order
+	sort.Strings(files)
+	return files, nil
+}
+
+func (c *Conf) LatestSnapshot() (string, error) {
+	snapshots, err := c.Snapshots()
+	if err != nil {
+		return "", err
+	}
+	if len(snapshots) == 0 {
+		return "", ErrNoSnapshot
+	}
+	return snapshots[len(snapshots)-1], nil
+}
+
+// VerifySnapshot opens a snapshot read only and checks that the buckets
+// exist, the schema is known and every ipcam can be decoded.
+func VerifySnapshot(snapshot string) error {
+	db, err := bolt.Open(snapshot, FILE_MODE, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(sysBucketName) == nil {
+			return ErrSnapshotNoSystem
+		}
+		p := tx.Bucket(ipcamsBucketName)
+		if p == nil {
+			return ErrSnapshotNoIpcams
+		}
+		v, err := schemaVersion(tx)
+		if err != nil {
+			return err
+		}
+		if v > latestSchemaVersion(migrations) {
+			return ErrSnapshotTooNew
+		}
+		return p.ForEach(func(ik, iv []byte) error {
+			b := p.Bucket(ik)
+			if b == nil {
+				return fmt.Errorf("ipcam %q is not a bucket", ik)
+			}
+			return checkIpcamBucket(ik, b)
+		})
+	})
+}
+
+func checkIpcamBucket(id []byte, b *bolt.Bucket) error {
+	for _, k := range [][]byte{K_IC_REC, K_IC_AUDIO_OFF, K_IC_OFF, K_IC_HAS_VIDEO, K_IC_HAS_AUDIO} {
+		if v := b.Get(k); v != nil {
+			if _, err := strconv.ParseBool(string(v)); err != nil {
+				return fmt.Errorf("ipcam %q %s: %v", id, k, err)
+			}
+		}
+	}
+	for _, k := range [][]byte{K_IC_WIDTH, K_IC_HEIGHT, K_IC_UPDATE_AT, K_IC_REV, K_IC_PROBED_AT} {
+		if v := b.Get(k); v != nil {
+			if _, err := strconv.ParseInt(string(v), 10, 64); err != nil {
+				return fmt.Errorf("ipcam %q %s: %v", id, k, err)
+			}
+		}
+	}
+	for _, k := range [][]byte{K_IC_GROUPS, K_IC_FEATURES} {
+		if v := b.Get(k); v != nil {
+			var ss []string
+			if err := json.Unmarshal(v, &ss); err != nil {
+				return fmt.Errorf("ipcam %q %s: %v", id, k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Restore verifies the snapshot and swaps it in place of DbPath.
+// The replaced database is kept as DbPath.pre-restore.
+// It must be called on a Conf that is not opened, with the client stopped.
+func (c *Conf) Restore(snapshot string) error {
+	if err := VerifySnapshot(snapshot); err != nil {
+		return fmt.Errorf("snapshot %s: %v", snapshot, err)
+	}
+
+	dbPath := c.setup.DbPath
+	if _, err := os.Stat(dbPath); err == nil {
+		live, err := bolt.Open(dbPath, FILE_MODE, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			if err == bolt.ErrTimeout {
+				return ErrDbInUse
+			}
+			glog.Warningln("current database cannot be opened:", err)
+		} else {
+			live.Close()
+		}
+		if err := copyFile(dbPath, dbPath+".pre-restore"); err != nil {
+			return err
+		}
+	}
+
+	tmp := dbPath + ".restoring"
+	if err := copyFile(snapshot, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	glog.Infoln("database restored from", snapshot)
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, FILE_MODE)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/boltdb/bolt"
+	"github.com/empirefox/ic-client-one/ipcam"
+)
+
+func newBackupConf(t *testing.T) (*TestConf, string) {
+	dir, err := ioutil.TempDir("", "ic-client-one-backup-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewTestConf()
+	c.setup.BackupDir = dir
+	c.setup.BackupKeep = 2
+	return c, dir
+}
+
+func TestConf_BackupRotate(t *testing.T) {
+	c, dir := newBackupConf(t)
+	defer os.RemoveAll(dir)
+	defer c.Close()
+
+	c.PutIpcam(&ipcam.Ipcam{Id: "a", Url: "aurl"})
+	name, err := c.Backup()
+	if err != nil {
+		t.Fatalf("backup failed, err: %v\n", err)
+	}
+	if err := VerifySnapshot(name); err != nil {
+		t.Errorf("backup should be a valid snapshot, err: %v\n", err)
+	}
+	if again, _ := c.Backup(); again == name {
+		t.Errorf("backups in the same second should not share a name: %s\n", name)
+	}
+
+	for _, old := range []string{"ic-room-20000101-000000.db", "ic-room-20000102-000000.db"} {
+		ioutil.WriteFile(dir+"/"+old, nil, FILE_MODE)
+	}
+	if _, err := c.Backup(); err != nil {
+		t.Fatalf("backup failed, err: %v\n", err)
+	}
+	snapshots, _ := c.Snapshots()
+	if len(snapshots) != 2 {
+		t.Errorf("should keep 2 snapshots, got: %v\n", snapshots)
+	}
+	if latest, _ := c.LatestSnapshot(); latest != snapshots[1] {
+		t.Errorf("latest snapshot should be the newest one\n")
+	}
+}
+
+func TestVerifySnapshot_Invalid(t *testing.T) {
+	db := openTempDb()
+	db.Update(func(tx *bolt.Tx) error {
+		tx.CreateBucket(sysBucketName)
+		b, _ := tx.CreateBucket(ipcamsBucketName)
+		i, _ := b.CreateBucket([]byte("a"))
+		return i.Put(ipcam.K_IC_WIDTH, []byte("wide"))
+	})
+	path := db.Path()
+	closeTempDb(db)
+	defer os.Remove(path)
+
+	if err := VerifySnapshot(path); err == nil {
+		t.Errorf("should refuse undecodable ipcam\n")
+	}
+
+	empty := openTempDb()
+	emptyPath := empty.Path()
+	closeTempDb(empty)
+	defer os.Remove(emptyPath)
+	if err := VerifySnapshot(emptyPath); err == nil {
+		t.Errorf("should refuse snapshot without buckets\n")
+	}
+}
+
+func TestConf_Restore(t *testing.T) {
+	c, dir := newBackupConf(t)
+	defer os.RemoveAll(dir)
+	dbPath := c.db.Path()
+	defer os.Remove(dbPath)
+	defer os.Remove(dbPath + ".pre-restore")
+
+	c.PutIpcam(&ipcam.Ipcam{Id: "a", Url: "aurl"})
+	snapshot, err := c.Backup()
+	if err != nil {
+		t.Fatalf("backup failed, err: %v\n", err)
+	}
+	c.RemoveIpcam([]byte("a"))
+
+	if err := c.Restore(snapshot); err != ErrDbInUse {
+		t.Errorf("should refuse to restore an open database, err: %v\n", err)
+	}
+	c.Conf.Close()
+
+	if err := c.Restore(snapshot); err != nil {
+		t.Fatalf("restore failed, err: %v\n", err)
+	}
+	if err := c.Open(); err != nil {
+		t.Fatalf("open restored db failed, err: %v\n", err)
+	}
+	defer c.Conf.Close()
+	if _, err := c.GetIpcam([]byte("a")); err != nil {
+		t.Errorf("restored db should contain the ipcam, err: %v\n", err)
+	}
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	. "github.com/empirefox/ic-client-one/ipcam"
+)
+
+var (
+	ErrIpcamUrlRequired = errors.New("ipcam url required")
+	ErrIpcamDuplicated  = errors.New("ipcam appears more than once in the batch")
+	ErrIpcamIdTaken     = errors.New("ipcam id is used by another ipcam")
+)
+
+// BatchError has an error per item, nil for the good ones.
+// Nothing of the batch is saved when it is returned.
+type BatchError struct {
+	Errs []error
+}
+
+func (e *BatchError) Error() string {
+	var msgs []string
+	for k, err := range e.Errs {
+		if err != nil {
+			msgs = append(msgs, fmt.Sprintf("item %d: %v", k, err))
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func batchError(errs []error) error {
+	for _, err := range errs {
+		if err != nil {
+			return &BatchError{errs}
+		}
+	}
+	return nil
+}
+
+func itemError(n, k int, err error) error {
+	errs := make([]error, n)
+	errs[k] = err
+	return &BatchError{errs}
+}
+
+// checkSetters validates a batch before anything is saved.
+// A new ipcam needs Url, a Target must exist and an id can be used once.
+func checkSetters(exists func(id string) bool, setters []SetterIpcam) []error {
+	errs := make([]error, len(setters))
+	targets := make(map[string]int)
+	for k, s := range setters {
+		if s.Target != "" {
+			if _, dup := targets[s.Target]; dup {
+				errs[k] = ErrIpcamDuplicated
+			}
+			targets[s.Target] = k
+		}
+	}
+	ids := make(map[string]bool)
+	for k, s := range setters {
+		if errs[k] != nil {
+			continue
+		}
+		id := s.Id
+		if id == "" {
+			id = s.Target
+		}
+		switch {
+		case id == "":
+			errs[k] = ErrIpcamIdRequired
+		case s.Target != "" && !exists(s.Target):
+			errs[k] = ErrIpcamNotFound
+		case s.Target == "" && s.Url == "":
+			errs[k] = ErrIpcamUrlRequired
+		case ids[id]:
+			errs[k] = ErrIpcamDuplicated
+		case id != s.Target && s.Target != "" && exists(id):
+			errs[k] = ErrIpcamIdTaken
+		default:
+			// renamed to the target of another item
+			if t, ok := targets[id]; ok && t != k {
+				errs[k] = ErrIpcamDuplicated
+			}
+		}
+		ids[id] = true
+	}
+	return errs
+}
+
+func checkRemoves(exists func(id string) bool, ids []string) []error {
+	errs := make([]error, len(ids))
+	seen := make(map[string]bool)
+	for k, id := range ids {
+		switch {
+		case id == "":
+			errs[k] = ErrIpcamIdRequired
+		case seen[id]:
+			errs[k] = ErrIpcamDuplicated
+		case !exists(id):
+			errs[k] = ErrIpcamNotFound
+		}
+		seen[id] = true
+	}
+	return errs
+}
+
+// SaveIpcams saves every setter in one transaction, or nothing.
+// Rev of each saved ipcam is updated.
+func (c *Conf) SaveIpcams(setters []SetterIpcam) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		p := tx.Bucket(ipcamsBucketName)
+		exists := func(id string) bool { return p.Bucket([]byte(id)) != nil }
+		if err := batchError(checkSetters(exists, setters)); err != nil {
+			return err
+		}
+		for k := range setters {
+			var target []byte
+			if setters[k].Target != "" {
+				target = []byte(setters[k].Target)
+			}
+			if err := c.putIpcam(p, &setters[k].Ipcam, target); err != nil {
+				return itemError(len(setters), k, err)
+			}
+		}
+		return nil
+	})
+}
+
+// RemoveIpcams removes every ipcam in one transaction, or nothing.
+func (c *Conf) RemoveIpcams(ids []string) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		p := tx.Bucket(ipcamsBucketName)
+		exists := func(id string) bool { return p.Bucket([]byte(id)) != nil }
+		if err := batchError(checkRemoves(exists, ids)); err != nil {
+			return err
+		}
+		for k, id := range ids {
+			err := p.DeleteBucket([]byte(id))
+			if err == nil {
+				err = removeHistory(tx, []byte(id))
+			}
+			if err == nil {
+				err = removeSchedule(tx, []byte(id))
+			}
+			if err != nil {
+				return itemError(len(ids), k, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/empirefox/ic-client-one/ipcam"
+)
+
+func setter(target, id, url string) ipcam.SetterIpcam {
+	return ipcam.SetterIpcam{Target: target, Ipcam: ipcam.Ipcam{Id: id, Url: url}}
+}
+
+func testStoreBatch(t *testing.T, s Store) {
+	s.PutIpcam(&ipcam.Ipcam{Id: "a", Url: "aurl"})
+	s.PutIpcam(&ipcam.Ipcam{Id: "b", Url: "burl"})
+
+	bad := []ipcam.SetterIpcam{
+		setter("", "c", "curl"),
+		setter("", "d", ""),
+		setter("none", "e", "eurl"),
+		setter("a", "b", "burl"),
+		setter("", "c", "curl2"),
+	}
+	err := s.SaveIpcams(bad)
+	be, ok := err.(*BatchError)
+	if !ok || len(be.Errs) != 5 {
+		t.Fatalf("should get BatchError, got: %v\n", err)
+	}
+	want := []error{nil, ErrIpcamUrlRequired, ErrIpcamNotFound, ErrIpcamIdTaken, ErrIpcamDuplicated}
+	for k := range want {
+		if be.Errs[k] != want[k] {
+			t.Errorf("item %d should get %v, got: %v\n", k, want[k], be.Errs[k])
+		}
+	}
+	if is := s.GetIpcams(); len(is) != 2 {
+		t.Errorf("nothing should be saved on error, got: %v\n", is)
+	}
+
+	stale := []ipcam.SetterIpcam{setter("", "c", "curl"), setter("a", "a", "aurl2")}
+	stale[1].Rev = 100
+	err = s.SaveIpcams(stale)
+	if be, ok := err.(*BatchError); !ok || be.Errs[1] != ErrIpcamConflict {
+		t.Errorf("should get conflict of item 1, got: %v\n", err)
+	}
+	if _, err := s.GetIpcam([]byte("c")); err == nil {
+		t.Errorf("nothing should be saved on conflict\n")
+	}
+
+	good := []ipcam.SetterIpcam{setter("", "c", "curl"), setter("a", "a2", "aurl2"), setter("b", "", "burl2")}
+	if err := s.SaveIpcams(good); err != nil {
+		t.Fatalf("failed to save batch, err: %v\n", err)
+	}
+	is := s.GetIpcams()
+	if len(is) != 3 || is["a2"].Url != "aurl2" || is["b"].Url != "burl2" || is["c"].Url != "curl" {
+		t.Errorf("should save every item, got: %v\n", is)
+	}
+	if good[1].Rev == 0 || good[1].Rev != is["a2"].Rev {
+		t.Errorf("should update rev of items, got: %d\n", good[1].Rev)
+	}
+
+	err = s.RemoveIpcams([]string{"a2", "none", "a2"})
+	if be, ok := err.(*BatchError); !ok || be.Errs[0] != nil || be.Errs[1] != ErrIpcamNotFound || be.Errs[2] != ErrIpcamDuplicated {
+		t.Errorf("should get errors of removes, got: %v\n", err)
+	}
+	if err := s.RemoveIpcams([]string{"a2", "c"}); err != nil {
+		t.Errorf("failed to remove batch, err: %v\n", err)
+	}
+	if is := s.GetIpcams(); len(is) != 1 || is["b"].Id != "b" {
+		t.Errorf("should only keep b, got: %v\n", is)
+	}
+}
+
+func TestStore_Batch(t *testing.T) {
+	c := NewTestConf()
+	defer c.Close()
+	testStoreBatch(t, c.Conf)
+	testStoreBatch(t, NewMemStore(0))
+}
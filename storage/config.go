@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"bytes"
+	"crypto/cipher"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -8,6 +10,7 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/boltdb/bolt"
@@ -17,16 +20,22 @@ import (
 
 const (
 	FILE_MODE os.FileMode = 0644
+
+	RETRY_BASE   = 5 * time.Second
+	RETRY_MAX    = 5 * time.Minute
+	RETRY_JITTER = 0.2
 )
 
 var (
 	ErrSystemBucketNotFound = errors.New("system bucket not found")
 	ErrSystemKeyNotFound    = errors.New("system key not found")
 	ErrIpcamNotFound        = errors.New("ipcam not found")
+	ErrIpcamConflict        = errors.New("ipcam was changed by someone else")
 	ErrDbPathRequired       = errors.New("DbPath must be set")
 	ErrRecDirRequired       = errors.New("RecDir must be set")
 	ErrWsUrlRequired        = errors.New("WsUrl must be set")
 	ErrPingSecond           = errors.New("PingSecond must greater than 30")
+	ErrBackupSecond         = errors.New("BackupSecond must greater than 60")
 	ErrSetupParam           = errors.New("setup is not a valid json file nor valid json content")
 	ErrEmptySetupParam      = errors.New("setup is empty")
 
@@ -43,35 +52,80 @@ type Setup struct {
 	WsUrl      string
 	PingSecond time.Duration
 	Stuns      []string
-}
+	IceServers []IceServer
 
-func (setup *Setup) Validate() error {
-	if setup.WsUrl == "" {
-		return ErrWsUrlRequired
-	}
-	if setup.PingSecond < 30 {
-		return ErrPingSecond
-	}
-	if setup.DbPath == "" {
-		return ErrDbPathRequired
-	}
-	if setup.RecDir == "" {
-		return ErrRecDirRequired
-	}
-	setup.DbPath = os.ExpandEnv(setup.DbPath)
-	setup.RecDir = os.ExpandEnv(setup.RecDir)
-	return nil
+	// optional, encrypt tokens and camera credentials at rest
+	SecretKeyFile string
+	SecretKeyEnv  string
+
+	// optional, snapshot the db every BackupSecond into BackupDir
+	BackupDir    string
+	BackupSecond time.Duration
+	BackupKeep   int
+
+	// status transitions kept per ipcam, default HISTORY_KEEP
+	HistoryKeep int
+
+	// optional, remove old recordings every RetentionSecond (default 600)
+	RetentionSecond time.Duration
+	RecKeepHour     time.Duration
+	RecCameraMaxMB  int64
+	RecMaxMB        int64
+	RecMinFreeMB    int64
+
+	// optional, disk_low below DiskLowMB until DiskOkMB (default 1.25x) is free,
+	// RecDir is checked every DiskCheckSecond (default 60)
+	DiskLowMB       int64
+	DiskOkMB        int64
+	DiskCheckSecond time.Duration
+
+	// event recording lasts EventPostSecond after the last trigger (default 30),
+	// and EventMaxSecond at most (default 600). A clip starts EventPreSecond
+	// before the trigger (default 5) when the camera was recording already.
+	EventPreSecond  time.Duration
+	EventPostSecond time.Duration
+	EventMaxSecond  time.Duration
+
+	// offline cameras retry after RetryBaseSecond (default 5), doubled after
+	// each failure up to RetryMaxSecond (default 300), moved by up to RetryJitter
+	// of itself (default 0.2)
+	RetryBaseSecond time.Duration
+	RetryMaxSecond  time.Duration
+	RetryJitter     float64
+
+	// optional, basic auth of /records, disabled without them
+	RecordsUser     string
+	RecordsPassword string
 }
 
 ///////////////////////////////////////////
 // Conf
 ///////////////////////////////////////////
 type Conf struct {
-	setup Setup
-	db    *bolt.DB
+	// guards the fields that Reload can change
+	mu          sync.RWMutex
+	setup       Setup
+	source      string
+	pingChanged chan struct{}
+
+	db   *bolt.DB
+	aead cipher.AEAD
 }
 
-func NewConf(str string) (*Conf, error) {
+// LoadSetup parses and validates setup.
+func LoadSetup(str string) (*Setup, error) {
+	setup, err := ParseSetup(str)
+	if err != nil {
+		return nil, err
+	}
+	if err := setup.Validate(); err != nil {
+		return nil, err
+	}
+	return setup, nil
+}
+
+// ParseSetup parses str as a setup file path, or as json content.
+func ParseSetup(str string) (*Setup, error) {
 	content, err1 := ioutil.ReadFile(str)
 	if err1 != nil {
 		content = []byte(str)
@@ -87,10 +141,24 @@ func NewConf(str string) (*Conf, error) {
 		}
 		return nil, err2
 	}
-	if err := setup.Validate(); err != nil {
+	return &setup, nil
+}
+
+func NewConf(str string) (*Conf, error) {
+	setup, err := LoadSetup(str)
+	if err != nil {
 		return nil, err
 	}
-	return &Conf{setup: setup}, nil
+	aead, err := setup.loadSecret()
+	if err != nil {
+		return nil, err
+	}
+	return &Conf{
+		setup:       *setup,
+		source:      str,
+		pingChanged: make(chan struct{}),
+		aead:        aead,
+	}, nil
 }
 
 func (c *Conf) Open() (err error) {
@@ -103,14 +171,17 @@ func (c *Conf) Open() (err error) {
 		return err
 	}
 
-	return c.db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(ipcamsBucketName)
-		if err != nil {
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		if err := migrate(c, tx, migrations); err != nil {
 			return err
 		}
-		_, err = tx.CreateBucketIfNotExists(sysBucketName)
-		return err
+		return c.onSecretKeyChanged(tx)
 	})
+	if err != nil {
+		glog.Errorln(err)
+		c.db.Close()
+	}
+	return err
 }
 
 func (c *Conf) Close() {
@@ -128,10 +199,23 @@ func (c *Conf) Get(k []byte) []byte {
 		}
 		return nil
 	})
+	if isSecretKey(k) {
+		plain, err := c.unseal(k, v)
+		if err != nil {
+			glog.Errorln(string(k), err)
+		}
+		return plain
+	}
 	return v
 }
 
 func (c *Conf) Put(k, v []byte) error {
+	if isSecretKey(k) {
+		var err error
+		if v, err = c.seal(k, v); err != nil {
+			return err
+		}
+	}
 	err := c.db.Update(func(tx *bolt.Tx) error {
 		return tx.Bucket(sysBucketName).Put(k, v)
 	})
@@ -146,12 +230,43 @@ func (c *Conf) Del(k []byte) error {
 }
 
 // used by lower ffmpeg
-func (c *Conf) GetStuns() []string            { return c.setup.Stuns }
 func (c *Conf) GetRecPrefix(id string) string { return path.Join(c.setup.RecDir, id) }
-func (c *Conf) GetPingSecond() time.Duration  { return c.setup.PingSecond * time.Second }
 func (c *Conf) GetRegToken() []byte           { return c.Get(K_REG_TOKEN) }
 func (c *Conf) GetRoomToken() []byte          { return c.Get(K_ROOM_TOKEN) }
 
+func (c *Conf) GetPingSecond() time.Duration {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.setup.PingSecond * time.Second
+}
+
+// GetRetryBackoff follows Reload.
+func (c *Conf) GetRetryBackoff() (base, max time.Duration, jitter float64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	base, max, jitter = c.setup.RetryBaseSecond*time.Second, c.setup.RetryMaxSecond*time.Second, c.setup.RetryJitter
+	if base <= 0 {
+		base = RETRY_BASE
+	}
+	if max <= 0 {
+		max = RETRY_MAX
+	}
+	if max < base {
+		max = base
+	}
+	if jitter <= 0 {
+		jitter = RETRY_JITTER
+	}
+	return base, max, jitter
+}
+
+// GetRecordsAuth returns empty user when /records is disabled.
+func (c *Conf) GetRecordsAuth() (user, password string) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.setup.RecordsUser, c.setup.RecordsPassword
+}
+
 func (c *Conf) GetIpcams() (is Ipcams) {
 	is = make(Ipcams, 0)
 	c.db.View(func(tx *bolt.Tx) error {
@@ -160,6 +275,7 @@ func (c *Conf) GetIpcams() (is Ipcams) {
 			if b := p.Bucket(ik); b != nil {
 				var i Ipcam
 				i.FromBucket(ik, b)
+				c.unsealIpcamUrl(&i)
 				is[string(ik)] = i
 			}
 			return nil
@@ -176,6 +292,7 @@ func (c *Conf) GetIpcam(id []byte) (i Ipcam, err error) {
 			return ErrIpcamNotFound
 		}
 		i.FromBucket(id, b)
+		c.unsealIpcamUrl(&i)
 		return nil
 	})
 	return i, err
@@ -184,47 +301,140 @@ func (c *Conf) GetIpcam(id []byte) (i Ipcam, err error) {
 // target will trigger remove then create new one
 func (c *Conf) PutIpcam(i *Ipcam, target ...[]byte) error {
 	err := c.db.Update(func(tx *bolt.Tx) error {
-		p := tx.Bucket(ipcamsBucketName)
-		if len(target) > 0 && len(target[0]) > 0 {
-			if err := p.DeleteBucket(target[0]); err != nil {
-				return err
-			}
-			if i.Id == "" {
-				i.Id = string(target[0])
-			}
-		}
-		b, err := p.CreateBucketIfNotExists([]byte(i.Id))
-		if err != nil {
-			return err
-		}
-		if err = b.Put(K_IC_URL, []byte(i.Url)); err != nil {
-			return err
+		var t []byte
+		if len(target) > 0 {
+			t = target[0]
 		}
-		if err = b.Put(K_IC_REC, []byte(strconv.FormatBool(i.Rec))); err != nil {
-			return err
-		}
-		if err = b.Put(K_IC_AUDIO_OFF, []byte(strconv.FormatBool(i.AudioOff))); err != nil {
+		return c.putIpcam(tx.Bucket(ipcamsBucketName), i, t)
+	})
+	return err
+}
+
+func (c *Conf) putIpcam(p *bolt.Bucket, i *Ipcam, target []byte) error {
+	src := target
+	if len(src) == 0 {
+		src = []byte(i.Id)
+	}
+	var rev int64
+	old := p.Bucket(src)
+	if old != nil {
+		rev, _ = strconv.ParseInt(string(old.Get(K_IC_REV)), 10, 64)
+	}
+	if i.Rev != 0 && (old == nil || i.Rev != rev) {
+		return ErrIpcamConflict
+	}
+
+	if len(target) > 0 {
+		if err := p.DeleteBucket(target); err != nil {
 			return err
 		}
-		if err = b.Put(K_IC_OFF, []byte(strconv.FormatBool(i.Off))); err != nil {
-			return err
+		if i.Id == "" {
+			i.Id = string(target)
 		}
-		if err = b.Put(K_IC_HAS_VIDEO, []byte(strconv.FormatBool(i.HasVideo))); err != nil {
-			return err
+		if i.Id != string(target) {
+			if err := moveHistory(p.Tx(), target, []byte(i.Id)); err != nil {
+				return err
+			}
+			if err := moveSchedule(p.Tx(), target, []byte(i.Id)); err != nil {
+				return err
+			}
 		}
-		if err = b.Put(K_IC_HAS_AUDIO, []byte(strconv.FormatBool(i.HasAudio))); err != nil {
-			return err
+	}
+	b, err := p.CreateBucketIfNotExists([]byte(i.Id))
+	if err != nil {
+		return err
+	}
+	u, err := c.sealIpcamUrl(i)
+	if err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_URL, u); err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_REC, []byte(strconv.FormatBool(i.Rec))); err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_AUDIO_OFF, []byte(strconv.FormatBool(i.AudioOff))); err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_OFF, []byte(strconv.FormatBool(i.Off))); err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_HAS_VIDEO, []byte(strconv.FormatBool(i.HasVideo))); err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_HAS_AUDIO, []byte(strconv.FormatBool(i.HasAudio))); err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_WIDTH, []byte(strconv.Itoa(i.Width))); err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_HEIGHT, []byte(strconv.Itoa(i.Height))); err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_REV, []byte(strconv.FormatInt(rev+1, 10))); err != nil {
+		return err
+	}
+	groups, err := json.Marshal(i.Groups)
+	if err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_GROUPS, groups); err != nil {
+		return err
+	}
+	if err = b.Put(K_IC_ONVIF, []byte(i.Onvif)); err != nil {
+		return err
+	}
+	if err = putIpcamDevice(b, i); err != nil {
+		return err
+	}
+	i.Rev = rev + 1
+	return b.Put(K_IC_UPDATE_AT, []byte(strconv.FormatInt(time.Now().Unix(), 10)))
+}
+
+func (c *Conf) PutIpcamStatus(i *Ipcam) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(ipcamsBucketName).Bucket([]byte(i.Id))
+		if b == nil {
+			return ErrIpcamNotFound
 		}
-		if err = b.Put(K_IC_WIDTH, []byte(strconv.Itoa(i.Width))); err != nil {
+		return putIpcamStatus(b, i)
+	})
+}
+
+func putIpcamStatus(b *bolt.Bucket, i *Ipcam) error {
+	for k, v := range map[string]string{
+		string(K_IC_HAS_VIDEO): strconv.FormatBool(i.HasVideo),
+		string(K_IC_HAS_AUDIO): strconv.FormatBool(i.HasAudio),
+		string(K_IC_WIDTH):     strconv.Itoa(i.Width),
+		string(K_IC_HEIGHT):    strconv.Itoa(i.Height),
+	} {
+		if err := b.Put([]byte(k), []byte(v)); err != nil {
 			return err
 		}
-		if err = b.Put(K_IC_HEIGHT, []byte(strconv.Itoa(i.Height))); err != nil {
+	}
+	return putIpcamDevice(b, i)
+}
+
+func putIpcamDevice(b *bolt.Bucket, i *Ipcam) error {
+	for k, v := range map[string]string{
+		string(K_IC_VENDOR):   i.Vendor,
+		string(K_IC_MODEL):    i.Model,
+		string(K_IC_FIRMWARE): i.Firmware,
+		string(K_IC_SERIAL):   i.Serial,
+	} {
+		if err := b.Put([]byte(k), []byte(v)); err != nil {
 			return err
 		}
-		err = b.Put(K_IC_UPDATE_AT, []byte(strconv.FormatInt(time.Now().Unix(), 10)))
+	}
+	features, err := json.Marshal(i.Features)
+	if err != nil {
 		return err
-	})
-	return err
+	}
+	if err = b.Put(K_IC_FEATURES, features); err != nil {
+		return err
+	}
+	return b.Put(K_IC_PROBED_AT, []byte(strconv.FormatInt(i.ProbedAt, 10)))
 }
 
 func (c *Conf) SetIpcamAttr(id, k, v []byte) error {
@@ -233,21 +443,41 @@ func (c *Conf) SetIpcamAttr(id, k, v []byte) error {
 		if b == nil {
 			return ErrIpcamNotFound
 		}
+		if bytes.Equal(k, K_IC_URL) && urlHasCredentials(v) {
+			var err error
+			if v, err = c.seal(ipcamUrlAD(id), v); err != nil {
+				return err
+			}
+		}
 		if err := b.Put(k, v); err != nil {
 			return err
 		}
+		rev, _ := strconv.ParseInt(string(b.Get(K_IC_REV)), 10, 64)
+		if err := b.Put(K_IC_REV, []byte(strconv.FormatInt(rev+1, 10))); err != nil {
+			return err
+		}
 		return b.Put(K_IC_UPDATE_AT, []byte(strconv.FormatInt(time.Now().Unix(), 10)))
 	})
 }
 
 func (c *Conf) RemoveIpcam(id []byte) error {
 	err := c.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket(ipcamsBucketName).DeleteBucket(id)
+		if err := tx.Bucket(ipcamsBucketName).DeleteBucket(id); err != nil {
+			return err
+		}
+		if err := removeHistory(tx, id); err != nil {
+			return err
+		}
+		return removeSchedule(tx, id)
 	})
 	return err
 }
 
-func (c *Conf) wsUrl(context string) string { return fmt.Sprintf("%s/one/%s", c.setup.WsUrl, context) }
+func (c *Conf) wsUrl(context string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return fmt.Sprintf("%s/one/%s", c.setup.WsUrl, context)
+}
 
 func (c *Conf) CtrlUrl() string                     { return c.wsUrl("ctrl") }
 func (c *Conf) SignalingUrl(reciever string) string { return c.wsUrl("signaling/" + reciever) }
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+	. "github.com/empirefox/ic-client-one/ipcam"
+)
+
+const HISTORY_KEEP = 1000
+
+var historyBucketName = []byte("history")
+
+func (c *Conf) historyKeep() uint64 {
+	if c.setup.HistoryKeep <= 0 {
+		return HISTORY_KEEP
+	}
+	return uint64(c.setup.HistoryKeep)
+}
+
+func seqKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
+
+// AppendIpcamHistory appends entries to the history of ipcam id,
+// then drops the oldest ones over HistoryKeep.
+func (c *Conf) AppendIpcamHistory(id string, hs ...History) error {
+	if len(hs) == 0 {
+		return nil
+	}
+	keep := c.historyKeep()
+	return c.db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.Bucket(historyBucketName).CreateBucketIfNotExists([]byte(id))
+		if err != nil {
+			return err
+		}
+		var seq uint64
+		for _, h := range hs {
+			v, err := json.Marshal(&h)
+			if err != nil {
+				return err
+			}
+			if seq, err = b.NextSequence(); err != nil {
+				return err
+			}
+			if err = b.Put(seqKey(seq), v); err != nil {
+				return err
+			}
+		}
+		if seq <= keep {
+			return nil
+		}
+		// collected first, a delete moves the cursor past the next key
+		var old [][]byte
+		cur := b.Cursor()
+		for k, _ := cur.First(); k != nil && binary.BigEndian.Uint64(k) <= seq-keep; k, _ = cur.Next() {
+			old = append(old, append([]byte(nil), k...))
+		}
+		for _, k := range old {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// GetIpcamHistory returns entries at or after since, newest first.
+// limit <= 0 means no limit.
+func (c *Conf) GetIpcamHistory(id string, since int64, limit int) ([]History, error) {
+	hs := make([]History, 0)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(historyBucketName).Bucket([]byte(id))
+		if b == nil {
+			return nil
+		}
+		cur := b.Cursor()
+		for k, v := cur.Last(); k != nil; k, v = cur.Prev() {
+			var h History
+			if err := json.Unmarshal(v, &h); err != nil {
+				return err
+			}
+			if h.At < since {
+				break
+			}
+			hs = append(hs, h)
+			if limit > 0 && len(hs) >= limit {
+				break
+			}
+		}
+		return nil
+	})
+	return hs, err
+}
+
+// moveHistory follows an ipcam id change.
+func moveHistory(tx *bolt.Tx, from, to []byte) error {
+	p := tx.Bucket(historyBucketName)
+	src := p.Bucket(from)
+	if src == nil {
+		return nil
+	}
+	if p.Bucket(to) != nil {
+		if err := p.DeleteBucket(to); err != nil {
+			return err
+		}
+	}
+	dst, err := p.CreateBucket(to)
+	if err != nil {
+		return err
+	}
+	if err = dst.SetSequence(src.Sequence()); err != nil {
+		return err
+	}
+	if err = src.ForEach(func(k, v []byte) error { return dst.Put(k, v) }); err != nil {
+		return err
+	}
+	return p.DeleteBucket(from)
+}
+
+func removeHistory(tx *bolt.Tx, id []byte) error {
+	err := tx.Bucket(historyBucketName).DeleteBucket(id)
+	if err == bolt.ErrBucketNotFound {
+		return nil
+	}
+	return err
+}
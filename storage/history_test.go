@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/empirefox/ic-client-one/ipcam"
+)
+
+func TestConf_IpcamHistory(t *testing.T) {
+	c := NewTestConf()
+	defer c.Close()
+	c.setup.HistoryKeep = 3
+
+	for at := int64(1); at <= 5; at++ {
+		if err := c.AppendIpcamHistory("a", ipcam.History{At: at, Type: ipcam.HISTORY_ONLINE}); err != nil {
+			t.Fatalf("append failed, err: %v\n", err)
+		}
+	}
+	hs, err := c.GetIpcamHistory("a", 0, 0)
+	if err != nil {
+		t.Fatalf("get history failed, err: %v\n", err)
+	}
+	if len(hs) != 3 || hs[0].At != 5 || hs[2].At != 3 {
+		t.Errorf("should keep newest 3 entries newest first, got: %v\n", hs)
+	}
+
+	if hs, _ = c.GetIpcamHistory("a", 4, 0); len(hs) != 2 {
+		t.Errorf("should filter by since, got: %v\n", hs)
+	}
+	if hs, _ = c.GetIpcamHistory("a", 0, 1); len(hs) != 1 || hs[0].At != 5 {
+		t.Errorf("should limit entries, got: %v\n", hs)
+	}
+	if hs, _ = c.GetIpcamHistory("none", 0, 0); len(hs) != 0 {
+		t.Errorf("should get empty history for unknown ipcam\n")
+	}
+}
+
+func TestConf_IpcamHistoryTrim(t *testing.T) {
+	c := NewTestConf()
+	defer c.Close()
+	c.setup.HistoryKeep = 3
+
+	var hs []ipcam.History
+	for at := int64(1); at <= 10; at++ {
+		hs = append(hs, ipcam.History{At: at, Type: ipcam.HISTORY_ONLINE})
+	}
+	if err := c.AppendIpcamHistory("a", hs...); err != nil {
+		t.Fatalf("append failed, err: %v\n", err)
+	}
+	if hs, _ := c.GetIpcamHistory("a", 0, 0); len(hs) != 3 || hs[0].At != 10 || hs[2].At != 8 {
+		t.Errorf("should keep newest 3 of one append, got: %v\n", hs)
+	}
+
+	c.setup.HistoryKeep = 1
+	c.AppendIpcamHistory("a", ipcam.History{At: 11, Type: ipcam.HISTORY_OFFLINE})
+	if hs, _ := c.GetIpcamHistory("a", 0, 0); len(hs) != 1 || hs[0].At != 11 {
+		t.Errorf("should trim to a lowered keep, got: %v\n", hs)
+	}
+}
+
+func TestConf_IpcamHistoryFollowsIpcam(t *testing.T) {
+	c := NewTestConf()
+	defer c.Close()
+
+	c.PutIpcam(&ipcam.Ipcam{Id: "a", Url: "aurl"})
+	c.AppendIpcamHistory("a", ipcam.History{At: 1, Type: ipcam.HISTORY_OFFLINE})
+
+	if err := c.PutIpcam(&ipcam.Ipcam{Id: "b", Url: "aurl"}, []byte("a")); err != nil {
+		t.Fatalf("change id failed, err: %v\n", err)
+	}
+	if hs, _ := c.GetIpcamHistory("b", 0, 0); len(hs) != 1 {
+		t.Errorf("history should move with id change, got: %v\n", hs)
+	}
+	if hs, _ := c.GetIpcamHistory("a", 0, 0); len(hs) != 0 {
+		t.Errorf("old id should have no history\n")
+	}
+
+	c.RemoveIpcam([]byte("b"))
+	if hs, _ := c.GetIpcamHistory("b", 0, 0); len(hs) != 0 {
+		t.Errorf("history should be removed with ipcam\n")
+	}
+}
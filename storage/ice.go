@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const ICE_CREDENTIAL_TTL = 24 * time.Hour
+
+var (
+	ErrIceServerUrls       = errors.New("IceServers entry must have Urls")
+	ErrIceServerCredential = errors.New("turn server needs Username with Credential or SharedSecret")
+)
+
+// IceServer is a stun or turn server. Turn servers take a static
+// Credential, or a SharedSecret to mint TURN REST api credentials.
+// Setup.Check refuses SharedSecret while the conductor cannot renew them.
+type IceServer struct {
+	Urls         []string
+	Username     string        `json:",omitempty"`
+	Credential   string        `json:",omitempty"`
+	SharedSecret string        `json:",omitempty"`
+	TtlSecond    time.Duration `json:",omitempty"`
+}
+
+func (s *IceServer) validate() error {
+	if len(s.Urls) == 0 {
+		return ErrIceServerUrls
+	}
+	for _, u := range s.Urls {
+		if strings.HasPrefix(u, "turn:") || strings.HasPrefix(u, "turns:") {
+			if s.SharedSecret == "" && (s.Username == "" || s.Credential == "") {
+				return ErrIceServerCredential
+			}
+		}
+	}
+	return nil
+}
+
+func (s *IceServer) Ttl() time.Duration {
+	if s.TtlSecond <= 0 {
+		return ICE_CREDENTIAL_TTL
+	}
+	return s.TtlSecond * time.Second
+}
+
+// Credentials returns the username and password to use now.
+// For SharedSecret, expires is when the minted credential stops working,
+// otherwise it is zero.
+func (s *IceServer) Credentials(now time.Time) (username, credential string, expires time.Time) {
+	if s.SharedSecret == "" {
+		return s.Username, s.Credential, time.Time{}
+	}
+	expires = now.Add(s.Ttl())
+	username = fmt.Sprintf("%d", expires.Unix())
+	if s.Username != "" {
+		username += ":" + s.Username
+	}
+	mac := hmac.New(sha1.New, []byte(s.SharedSecret))
+	mac.Write([]byte(username))
+	credential = base64.StdEncoding.EncodeToString(mac.Sum(nil))
+	return username, credential, expires
+}
+
+// GetIceServers returns Stuns as plain servers, followed by IceServers.
+func (c *Conf) GetIceServers() []IceServer {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.setup.iceServers()
+}
+
+func (setup *Setup) iceServers() []IceServer {
+	servers := make([]IceServer, 0, len(setup.Stuns)+len(setup.IceServers))
+	for _, stun := range setup.Stuns {
+		servers = append(servers, IceServer{Urls: []string{stun}})
+	}
+	return append(servers, setup.IceServers...)
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIceServer_Credentials(t *testing.T) {
+	static := IceServer{Urls: []string{"turn:a:3478"}, Username: "u", Credential: "p"}
+	if u, p, exp := static.Credentials(time.Now()); u != "u" || p != "p" || !exp.IsZero() {
+		t.Errorf("static credentials should be returned as is\n")
+	}
+
+	shared := IceServer{Urls: []string{"turn:a:3478"}, Username: "room", SharedSecret: "secret", TtlSecond: 600}
+	now := time.Unix(1000, 0)
+	u, p, exp := shared.Credentials(now)
+	if u != "1600:room" || !exp.Equal(time.Unix(1600, 0)) {
+		t.Errorf("should mint expiring username, got: %s %v\n", u, exp)
+	}
+	mac := hmac.New(sha1.New, []byte("secret"))
+	mac.Write([]byte(u))
+	if p != base64.StdEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("should sign username with shared secret\n")
+	}
+}
+
+func TestSetup_IceServers(t *testing.T) {
+	content := `{
+		"DbPath": "%s",
+		"RecDir": "/tmp/ic-client-one-rec-dir",
+		"WsUrl": "ws://127.0.0.1:9998",
+		"PingSecond": 50,
+		"Stuns": ["stun.ekiga.net"],
+		"IceServers": [%s]
+	}`
+	c, err := NewConf(fmt.Sprintf(content, tempfile(), `{"Urls":["turn:a:3478","turns:a:5349"],"Username":"u","Credential":"p"}`))
+	if err != nil {
+		t.Fatalf("NewConf failed, err: %v\n", err)
+	}
+	servers := c.GetIceServers()
+	if len(servers) != 2 || servers[0].Urls[0] != "stun.ekiga.net" || len(servers[1].Urls) != 2 {
+		t.Errorf("should merge Stuns and IceServers, got: %v\n", servers)
+	}
+
+	if _, err := NewConf(fmt.Sprintf(content, tempfile(), `{"Urls":["turn:a:3478"],"Username":"u"}`)); !errors.Is(err, ErrIceServerCredential) {
+		t.Errorf("should require turn credential, err: %v\n", err)
+	}
+	if _, err := NewConf(fmt.Sprintf(content, tempfile(), `{"Urls":["turn:a:3478"],"SharedSecret":"s"}`)); !errors.Is(err, ErrIceSharedSecret) {
+		t.Errorf("should refuse shared secret the conductor cannot renew, err: %v\n", err)
+	}
+	if _, err := NewConf(fmt.Sprintf(content, tempfile(), `{"Username":"u"}`)); !errors.Is(err, ErrIceServerUrls) {
+		t.Errorf("should require urls, err: %v\n", err)
+	}
+	if !strings.HasPrefix(servers[1].Urls[1], "turns:") {
+		t.Errorf("should keep url order\n")
+	}
+}
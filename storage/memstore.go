@@ -0,0 +1,308 @@
+package storage
+
+import (
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	. "github.com/empirefox/ic-client-one/ipcam"
+	"github.com/empirefox/ic-client-one/schedule"
+)
+
+// MemStore keeps everything in memory, nothing survives Close.
+type MemStore struct {
+	mu          sync.RWMutex
+	sys         map[string][]byte
+	ipcams      map[string]Ipcam
+	history     map[string][]History
+	schedules   schedule.Schedules
+	historyKeep int
+}
+
+func NewMemStore(historyKeep int) *MemStore {
+	if historyKeep <= 0 {
+		historyKeep = HISTORY_KEEP
+	}
+	return &MemStore{
+		sys:         make(map[string][]byte),
+		ipcams:      make(map[string]Ipcam),
+		history:     make(map[string][]History),
+		schedules:   make(schedule.Schedules),
+		historyKeep: historyKeep,
+	}
+}
+
+func (s *MemStore) Close() {}
+
+func (s *MemStore) Get(k []byte) []byte {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	v, ok := s.sys[string(k)]
+	if !ok || len(v) == 0 {
+		return nil
+	}
+	return append([]byte(nil), v...)
+}
+
+func (s *MemStore) Put(k, v []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sys[string(k)] = append([]byte(nil), v...)
+	return nil
+}
+
+func (s *MemStore) Del(k []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sys, string(k))
+	return nil
+}
+
+func (s *MemStore) GetIpcams() Ipcams {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	is := make(Ipcams, len(s.ipcams))
+	for id, i := range s.ipcams {
+		is[id] = i
+	}
+	return is
+}
+
+func (s *MemStore) GetIpcam(id []byte) (Ipcam, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i, ok := s.ipcams[string(id)]
+	if !ok {
+		return i, ErrIpcamNotFound
+	}
+	return i, nil
+}
+
+func (s *MemStore) PutIpcam(i *Ipcam, target ...[]byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putIpcam(i, target...)
+}
+
+func (s *MemStore) putIpcam(i *Ipcam, target ...[]byte) error {
+	src := i.Id
+	if len(target) > 0 && len(target[0]) > 0 {
+		src = string(target[0])
+	}
+	old, exist := s.ipcams[src]
+	if i.Rev != 0 && (!exist || i.Rev != old.Rev) {
+		return ErrIpcamConflict
+	}
+
+	if len(target) > 0 && len(target[0]) > 0 {
+		t := string(target[0])
+		if _, ok := s.ipcams[t]; !ok {
+			return ErrIpcamNotFound
+		}
+		if i.Id == "" {
+			i.Id = t
+		}
+		delete(s.ipcams, t)
+		if i.Id != t {
+			if hs, ok := s.history[t]; ok {
+				s.history[i.Id] = hs
+				delete(s.history, t)
+			}
+			if sc, ok := s.schedules[t]; ok {
+				sc.Camera = i.Id
+				s.schedules[i.Id] = sc
+				delete(s.schedules, t)
+			}
+		}
+	}
+	if i.Id == "" {
+		return ErrIpcamIdRequired
+	}
+	stored := *i
+	stored.Groups = append([]string(nil), i.Groups...)
+	stored.Features = append([]string(nil), i.Features...)
+	// runtime only, like the bolt store
+	stored.ClearRuntime()
+	stored.UpdatedAt = time.Now().Unix()
+	stored.Rev = old.Rev + 1
+	i.Rev = stored.Rev
+	s.ipcams[i.Id] = stored
+	return nil
+}
+
+func (s *MemStore) PutIpcamStatus(i *Ipcam) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.ipcams[i.Id]
+	if !ok {
+		return ErrIpcamNotFound
+	}
+	stored.HasVideo, stored.HasAudio = i.HasVideo, i.HasAudio
+	stored.Width, stored.Height = i.Width, i.Height
+	stored.CopyDevice(i)
+	s.ipcams[i.Id] = stored
+	return nil
+}
+
+// SetIpcamAttr accepts the same keys and encoding as the bolt store.
+func (s *MemStore) SetIpcamAttr(id, k, v []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i, ok := s.ipcams[string(id)]
+	if !ok {
+		return ErrIpcamNotFound
+	}
+	if err := setIpcamField(&i, k, v); err != nil {
+		return err
+	}
+	i.UpdatedAt = time.Now().Unix()
+	i.Rev++
+	s.ipcams[i.Id] = i
+	return nil
+}
+
+func (s *MemStore) RemoveIpcam(id []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ipcams[string(id)]; !ok {
+		return ErrIpcamNotFound
+	}
+	s.removeIpcam(string(id))
+	return nil
+}
+
+func (s *MemStore) removeIpcam(id string) {
+	delete(s.ipcams, id)
+	delete(s.history, id)
+	delete(s.schedules, id)
+}
+
+// SaveIpcams checks every Rev first, so nothing can fail half way.
+func (s *MemStore) SaveIpcams(setters []SetterIpcam) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exists := func(id string) bool { _, ok := s.ipcams[id]; return ok }
+	errs := checkSetters(exists, setters)
+	for k := range setters {
+		src := setters[k].Target
+		if src == "" {
+			src = setters[k].Id
+		}
+		if old, ok := s.ipcams[src]; errs[k] == nil && setters[k].Rev != 0 && (!ok || old.Rev != setters[k].Rev) {
+			errs[k] = ErrIpcamConflict
+		}
+	}
+	if err := batchError(errs); err != nil {
+		return err
+	}
+	for k := range setters {
+		var target []byte
+		if setters[k].Target != "" {
+			target = []byte(setters[k].Target)
+		}
+		s.putIpcam(&setters[k].Ipcam, target)
+	}
+	return nil
+}
+
+func (s *MemStore) RemoveIpcams(ids []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	exists := func(id string) bool { _, ok := s.ipcams[id]; return ok }
+	if err := batchError(checkRemoves(exists, ids)); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		s.removeIpcam(id)
+	}
+	return nil
+}
+
+func (s *MemStore) AppendIpcamHistory(id string, hs ...History) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	all := append(s.history[id], hs...)
+	if len(all) > s.historyKeep {
+		all = append([]History(nil), all[len(all)-s.historyKeep:]...)
+	}
+	s.history[id] = all
+	return nil
+}
+
+func (s *MemStore) GetIpcamHistory(id string, since int64, limit int) ([]History, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	all := s.history[id]
+	hs := make([]History, 0)
+	for k := len(all) - 1; k >= 0; k-- {
+		if all[k].At < since {
+			break
+		}
+		hs = append(hs, all[k])
+		if limit > 0 && len(hs) >= limit {
+			break
+		}
+	}
+	return hs, nil
+}
+
+func (s *MemStore) GetSchedules() (schedule.Schedules, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	ss := make(schedule.Schedules, len(s.schedules))
+	for id, sc := range s.schedules {
+		sc.Windows = append([]schedule.Window(nil), sc.Windows...)
+		ss[id] = sc
+	}
+	return ss, nil
+}
+
+func (s *MemStore) PutSchedule(sc *schedule.Schedule) error {
+	if err := sc.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.ipcams[sc.Camera]; !ok {
+		return ErrIpcamNotFound
+	}
+	stored := *sc
+	stored.Windows = append([]schedule.Window(nil), sc.Windows...)
+	s.schedules[sc.Camera] = stored
+	return nil
+}
+
+func (s *MemStore) RemoveSchedule(id []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.schedules, string(id))
+	return nil
+}
+
+func setIpcamField(i *Ipcam, k, v []byte) (err error) {
+	switch string(k) {
+	case string(K_IC_URL):
+		i.Url = string(v)
+	case string(K_IC_REC):
+		i.Rec, err = strconv.ParseBool(string(v))
+	case string(K_IC_AUDIO_OFF):
+		i.AudioOff, err = strconv.ParseBool(string(v))
+	case string(K_IC_OFF):
+		i.Off, err = strconv.ParseBool(string(v))
+	case string(K_IC_HAS_VIDEO):
+		i.HasVideo, err = strconv.ParseBool(string(v))
+	case string(K_IC_HAS_AUDIO):
+		i.HasAudio, err = strconv.ParseBool(string(v))
+	case string(K_IC_WIDTH):
+		i.Width, err = strconv.Atoi(string(v))
+	case string(K_IC_HEIGHT):
+		i.Height, err = strconv.Atoi(string(v))
+	case string(K_IC_ONVIF):
+		i.Onvif = string(v)
+	case string(K_IC_GROUPS):
+		i.Groups = nil
+		err = json.Unmarshal(v, &i.Groups)
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/boltdb/bolt"
+	"github.com/golang/glog"
+)
+
+var (
+	ErrSchemaTooNew = errors.New("database schema is newer than this client")
+
+	K_SCHEMA_VERSION = []byte("SchemaVersion")
+)
+
+// migration upgrades the database from Version-1 to Version.
+// Up runs inside the same transaction as every other pending step.
+type migration struct {
+	Version int
+	Name    string
+	Up      func(c *Conf, tx *bolt.Tx) error
+}
+
+// migrations must be ordered by Version, starting at 1 without gaps.
+// Never edit a released step, append a new one instead.
+var migrations = []migration{
+	{1, "create ipcams and system buckets", func(c *Conf, tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(ipcamsBucketName); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists(sysBucketName)
+		return err
+	}},
+	{2, "create history bucket", func(c *Conf, tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(historyBucketName)
+		return err
+	}},
+	{3, "create schedules bucket", func(c *Conf, tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(schedulesBucketName)
+		return err
+	}},
+	{4, "bind sealed urls to ipcam ids and seal plaintext secrets", func(c *Conf, tx *bolt.Tx) error {
+		if err := c.rebindIpcamUrls(tx); err != nil {
+			return err
+		}
+		return c.sealPlaintext(tx)
+	}},
+}
+
+func latestSchemaVersion(ms []migration) int {
+	if len(ms) == 0 {
+		return 0
+	}
+	return ms[len(ms)-1].Version
+}
+
+// schemaVersion returns 0 when the system bucket or key does not exist yet.
+func schemaVersion(tx *bolt.Tx) (int, error) {
+	b := tx.Bucket(sysBucketName)
+	if b == nil {
+		return 0, nil
+	}
+	v := b.Get(K_SCHEMA_VERSION)
+	if v == nil {
+		return 0, nil
+	}
+	return strconv.Atoi(string(v))
+}
+
+// migrate applies every step newer than the stored schema version.
+func migrate(c *Conf, tx *bolt.Tx, ms []migration) error {
+	for i, m := range ms {
+		if m.Version != i+1 {
+			return fmt.Errorf("migration %q has version %d, want %d", m.Name, m.Version, i+1)
+		}
+	}
+
+	current, err := schemaVersion(tx)
+	if err != nil {
+		return err
+	}
+	latest := latestSchemaVersion(ms)
+	if current > latest {
+		glog.Errorf("database schema version %d, client supports up to %d\n", current, latest)
+		return ErrSchemaTooNew
+	}
+	if current == latest {
+		return nil
+	}
+
+	for _, m := range ms[current:] {
+		if err := m.Up(c, tx); err != nil {
+			return fmt.Errorf("migration %d (%s): %v", m.Version, m.Name, err)
+		}
+		glog.Infof("database migrated to schema %d: %s\n", m.Version, m.Name)
+	}
+
+	b, err := tx.CreateBucketIfNotExists(sysBucketName)
+	if err != nil {
+		return err
+	}
+	return b.Put(K_SCHEMA_VERSION, []byte(strconv.Itoa(latest)))
+}
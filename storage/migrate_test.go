@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+func openTempDb() *bolt.DB {
+	db, err := bolt.Open(tempfile(), FILE_MODE, nil)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func closeTempDb(db *bolt.DB) {
+	defer os.Remove(db.Path())
+	db.Close()
+}
+
+func TestMigrate_Fresh(t *testing.T) {
+	c := NewTestConf()
+	defer c.Close()
+
+	if v := string(c.Get(K_SCHEMA_VERSION)); v != strconv.Itoa(latestSchemaVersion(migrations)) {
+		t.Errorf("schema version should be latest after open, got: %q\n", v)
+	}
+}
+
+func TestMigrate_Ordered(t *testing.T) {
+	db := openTempDb()
+	defer closeTempDb(db)
+
+	var applied []int
+	step := func(v int) migration {
+		return migration{v, "step " + strconv.Itoa(v), func(c *Conf, tx *bolt.Tx) error {
+			applied = append(applied, v)
+			return nil
+		}}
+	}
+	ms := []migration{step(1), step(2)}
+
+	if err := db.Update(func(tx *bolt.Tx) error { return migrate(nil, tx, ms) }); err != nil {
+		t.Fatalf("migrate failed, err: %v\n", err)
+	}
+	ms = append(ms, step(3))
+	if err := db.Update(func(tx *bolt.Tx) error { return migrate(nil, tx, ms) }); err != nil {
+		t.Fatalf("migrate failed, err: %v\n", err)
+	}
+
+	if len(applied) != 3 || applied[0] != 1 || applied[1] != 2 || applied[2] != 3 {
+		t.Errorf("each step should run once in order, got: %v\n", applied)
+	}
+}
+
+func TestMigrate_Gap(t *testing.T) {
+	db := openTempDb()
+	defer closeTempDb(db)
+
+	noop := func(c *Conf, tx *bolt.Tx) error { return nil }
+	ms := []migration{{1, "one", noop}, {3, "three", noop}}
+	if err := db.Update(func(tx *bolt.Tx) error { return migrate(nil, tx, ms) }); err == nil {
+		t.Errorf("should refuse a registry with gaps\n")
+	}
+}
+
+func TestMigrate_Rollback(t *testing.T) {
+	db := openTempDb()
+	defer closeTempDb(db)
+
+	failed := errors.New("failed")
+	ms := []migration{
+		{1, "one", func(c *Conf, tx *bolt.Tx) error {
+			_, err := tx.CreateBucket([]byte("one"))
+			return err
+		}},
+		{2, "two", func(c *Conf, tx *bolt.Tx) error { return failed }},
+	}
+	if err := db.Update(func(tx *bolt.Tx) error { return migrate(nil, tx, ms) }); err == nil {
+		t.Errorf("should get error from failed step\n")
+	}
+
+	db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte("one")) != nil {
+			t.Errorf("earlier steps should be rolled back\n")
+		}
+		if v, _ := schemaVersion(tx); v != 0 {
+			t.Errorf("schema version should not change, got: %d\n", v)
+		}
+		return nil
+	})
+}
+
+func TestMigrate_TooNew(t *testing.T) {
+	c := NewTestConf()
+	path := c.db.Path()
+	next := strconv.Itoa(latestSchemaVersion(migrations) + 1)
+	if err := c.Put(K_SCHEMA_VERSION, []byte(next)); err != nil {
+		t.Fatalf("failed to put schema version, err: %v\n", err)
+	}
+	c.Conf.Close()
+	defer os.Remove(path)
+
+	if err := c.Open(); err != ErrSchemaTooNew {
+		t.Errorf("should refuse to open newer schema, err: %v\n", err)
+	}
+}
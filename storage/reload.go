@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+)
+
+var (
+	ErrSetupNotFile = errors.New("setup is json content, not a file")
+)
+
+// SetupChanges describes what Reload applied, and what needs a restart.
+type SetupChanges struct {
+	IceAdded   []IceServer `json:",omitempty"`
+	IceRemoved []IceServer `json:",omitempty"`
+	PingSecond bool        `json:",omitempty"`
+	WsUrl      bool        `json:",omitempty"`
+	// fields changed in file but only applied after restart
+	Restart []string `json:",omitempty"`
+}
+
+func (ch *SetupChanges) Empty() bool {
+	return len(ch.IceAdded) == 0 && len(ch.IceRemoved) == 0 &&
+		!ch.PingSecond && !ch.WsUrl && len(ch.Restart) == 0
+}
+
+// SetupFile returns the setup file path, or "" when setup was given as content.
+func (c *Conf) SetupFile() string {
+	if _, err := ioutil.ReadFile(c.source); err != nil {
+		return ""
+	}
+	return c.source
+}
+
+// PingChanged is closed when Reload changes PingSecond.
+// Get it again after it fires.
+func (c *Conf) PingChanged() <-chan struct{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.pingChanged
+}
+
+// Reload reads the setup file again and applies the fields that can change
+// live: Stuns, IceServers, PingSecond, WsUrl, the recording quotas,
+// auth, disk thresholds, event rolls and retry backoff.
+// Other changes are reported in Restart.
+func (c *Conf) Reload() (*SetupChanges, error) {
+	file := c.SetupFile()
+	if file == "" {
+		return nil, ErrSetupNotFile
+	}
+	next, err := LoadSetup(file)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prev := &c.setup
+	ch := new(SetupChanges)
+
+	ch.IceAdded = diffIceServers(next.iceServers(), prev.iceServers())
+	ch.IceRemoved = diffIceServers(prev.iceServers(), next.iceServers())
+	// cannot remove ice servers from a running conductor
+	if len(ch.IceRemoved) != 0 {
+		ch.Restart = append(ch.Restart, "IceServers")
+	}
+	prev.Stuns, prev.IceServers = next.Stuns, next.IceServers
+
+	if next.PingSecond != prev.PingSecond {
+		ch.PingSecond = true
+		prev.PingSecond = next.PingSecond
+		close(c.pingChanged)
+		c.pingChanged = make(chan struct{})
+	}
+	if next.WsUrl != prev.WsUrl {
+		ch.WsUrl = true
+		prev.WsUrl = next.WsUrl
+	}
+
+	prev.RecKeepHour, prev.RecCameraMaxMB = next.RecKeepHour, next.RecCameraMaxMB
+	prev.RecMaxMB, prev.RecMinFreeMB = next.RecMaxMB, next.RecMinFreeMB
+	prev.RecordsUser, prev.RecordsPassword = next.RecordsUser, next.RecordsPassword
+	prev.DiskLowMB, prev.DiskOkMB = next.DiskLowMB, next.DiskOkMB
+	prev.EventPreSecond, prev.EventPostSecond, prev.EventMaxSecond = next.EventPreSecond, next.EventPostSecond, next.EventMaxSecond
+	prev.RetryBaseSecond, prev.RetryMaxSecond, prev.RetryJitter = next.RetryBaseSecond, next.RetryMaxSecond, next.RetryJitter
+	if next.DiskCheckSecond != prev.DiskCheckSecond {
+		ch.Restart = append(ch.Restart, "DiskCheckSecond")
+	}
+	if next.RetentionSecond != prev.RetentionSecond {
+		ch.Restart = append(ch.Restart, "RetentionSecond")
+	}
+
+	if next.DbPath != prev.DbPath {
+		ch.Restart = append(ch.Restart, "DbPath")
+	}
+	if next.RecDir != prev.RecDir {
+		ch.Restart = append(ch.Restart, "RecDir")
+	}
+	if next.SecretKeyFile != prev.SecretKeyFile || next.SecretKeyEnv != prev.SecretKeyEnv {
+		ch.Restart = append(ch.Restart, "SecretKey")
+	}
+	if next.BackupDir != prev.BackupDir || next.BackupSecond != prev.BackupSecond || next.BackupKeep != prev.BackupKeep {
+		ch.Restart = append(ch.Restart, "Backup")
+	}
+	return ch, nil
+}
+
+// SetupModTime is used to poll the setup file for changes.
+func (c *Conf) SetupModTime() (int64, error) {
+	fi, err := os.Stat(c.source)
+	if err != nil {
+		return 0, err
+	}
+	return fi.ModTime().UnixNano(), nil
+}
+
+// diffIceServers returns the items of a that are not in b.
+func diffIceServers(a, b []IceServer) []IceServer {
+	var d []IceServer
+	for _, s := range a {
+		found := false
+		for _, t := range b {
+			if reflect.DeepEqual(s, t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			d = append(d, s)
+		}
+	}
+	return d
+}
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+const reloadContent = `{
+	"DbPath": "%s",
+	"RecDir": "%s",
+	"WsUrl": "%s",
+	"PingSecond": %d,
+	"Stuns": %s
+}`
+
+func TestConf_Reload(t *testing.T) {
+	f, _ := ioutil.TempFile("", "ic-client-one-setup-")
+	f.Close()
+	defer os.Remove(f.Name())
+	db := tempfile()
+	defer os.Remove(db)
+
+	write := func(recDir, wsUrl string, ping int, stuns string) {
+		content := fmt.Sprintf(reloadContent, db, recDir, wsUrl, ping, stuns)
+		if err := ioutil.WriteFile(f.Name(), []byte(content), FILE_MODE); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("/tmp/rec", "ws://a", 50, `["s1:3478","s2:3478"]`)
+
+	c, err := NewConf(f.Name())
+	if err != nil {
+		t.Fatalf("NewConf failed, err: %v\n", err)
+	}
+	if c.SetupFile() != f.Name() {
+		t.Errorf("should know the setup file\n")
+	}
+	pingChanged := c.PingChanged()
+
+	write("/tmp/rec2", "ws://b", 60, `["s2:3478","s3:3478"]`)
+	ch, err := c.Reload()
+	if err != nil {
+		t.Fatalf("Reload failed, err: %v\n", err)
+	}
+	if len(ch.IceAdded) != 1 || ch.IceAdded[0].Urls[0] != "s3:3478" {
+		t.Errorf("should report added stun, got: %v\n", ch.IceAdded)
+	}
+	if len(ch.IceRemoved) != 1 || ch.IceRemoved[0].Urls[0] != "s1:3478" {
+		t.Errorf("should report removed stun, got: %v\n", ch.IceRemoved)
+	}
+	if !ch.PingSecond || c.GetPingSecond().Seconds() != 60 {
+		t.Errorf("should apply PingSecond\n")
+	}
+	select {
+	case <-pingChanged:
+	default:
+		t.Errorf("should signal ping change\n")
+	}
+	if !ch.WsUrl || c.CtrlUrl() != "ws://b/one/ctrl" {
+		t.Errorf("should apply WsUrl, got: %s\n", c.CtrlUrl())
+	}
+	if len(ch.Restart) != 2 || ch.Restart[0] != "IceServers" || ch.Restart[1] != "RecDir" {
+		t.Errorf("should report fields need restart, got: %v\n", ch.Restart)
+	}
+	if c.GetRecPrefix("a") != "/tmp/rec/a" {
+		t.Errorf("should not apply RecDir live\n")
+	}
+
+	write("/tmp/rec", "", 50, `[]`)
+	if _, err := c.Reload(); !errors.Is(err, ErrWsUrlRequired) {
+		t.Errorf("should validate reloaded setup, err: %v\n", err)
+	}
+	if c.CtrlUrl() != "ws://b/one/ctrl" {
+		t.Errorf("should keep setup when reload failed\n")
+	}
+}
+
+func TestConf_ReloadContent(t *testing.T) {
+	c, err := NewConf(newSetup())
+	if err != nil {
+		t.Fatalf("NewConf failed, err: %v\n", err)
+	}
+	if _, err := c.Reload(); err != ErrSetupNotFile {
+		t.Errorf("should not reload json content, err: %v\n", err)
+	}
+}
@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/empirefox/ic-client-one/records"
+)
+
+const MB = 1 << 20
+
+// GetRetentionInterval does not depend on the quotas, they follow Reload
+// and each run skips when none is set.
+func (c *Conf) GetRetentionInterval() time.Duration {
+	if c.setup.RetentionSecond <= 0 {
+		return records.RETENTION_INTERVAL
+	}
+	return c.setup.RetentionSecond * time.Second
+}
+
+// GetRetentionPolicy follows Reload.
+func (c *Conf) GetRetentionPolicy() records.Policy {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return records.Policy{
+		MaxAge:            c.setup.RecKeepHour * time.Hour,
+		MaxBytesPerCamera: c.setup.RecCameraMaxMB * MB,
+		MaxBytes:          c.setup.RecMaxMB * MB,
+		MinFreeBytes:      c.setup.RecMinFreeMB * MB,
+	}
+}
+
+func (c *Conf) GetRecDir() string { return c.setup.RecDir }
+
+func (c *Conf) GetDiskCheckInterval() time.Duration {
+	if c.setup.DiskCheckSecond <= 0 {
+		return records.DISK_CHECK_INTERVAL
+	}
+	return c.setup.DiskCheckSecond * time.Second
+}
+
+// GetDiskThresholds follows Reload, low is 0 when disabled.
+func (c *Conf) GetDiskThresholds() (low, ok int64) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	low, ok = c.setup.DiskLowMB*MB, c.setup.DiskOkMB*MB
+	if ok <= 0 {
+		ok = low + low/4
+	}
+	return low, ok
+}
+
+// GetEventRoll follows Reload.
+func (c *Conf) GetEventRoll() (pre, post, max time.Duration) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	pre, post, max = c.setup.EventPreSecond*time.Second, c.setup.EventPostSecond*time.Second, c.setup.EventMaxSecond*time.Second
+	if pre <= 0 {
+		pre = records.EVENT_PRE_ROLL
+	}
+	if post <= 0 {
+		post = records.EVENT_POST_ROLL
+	}
+	if max <= 0 {
+		max = records.EVENT_MAX_LENGTH
+	}
+	return pre, post, max
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+	"github.com/empirefox/ic-client-one/schedule"
+)
+
+var schedulesBucketName = []byte("schedules")
+
+func (c *Conf) GetSchedules() (schedule.Schedules, error) {
+	ss := make(schedule.Schedules)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucketName).ForEach(func(k, v []byte) error {
+			var s schedule.Schedule
+			if err := json.Unmarshal(v, &s); err != nil {
+				return err
+			}
+			ss[s.Camera] = s
+			return nil
+		})
+	})
+	return ss, err
+}
+
+// PutSchedule replaces the schedule of s.Camera, the ipcam must exist.
+func (c *Conf) PutSchedule(s *schedule.Schedule) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	v, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(ipcamsBucketName).Bucket([]byte(s.Camera)) == nil {
+			return ErrIpcamNotFound
+		}
+		return tx.Bucket(schedulesBucketName).Put([]byte(s.Camera), v)
+	})
+}
+
+func (c *Conf) RemoveSchedule(id []byte) error {
+	return c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(schedulesBucketName).Delete(id)
+	})
+}
+
+// moveSchedule follows an ipcam id change.
+func moveSchedule(tx *bolt.Tx, from, to []byte) error {
+	b := tx.Bucket(schedulesBucketName)
+	v := b.Get(from)
+	if v == nil {
+		return nil
+	}
+	var s schedule.Schedule
+	if err := json.Unmarshal(v, &s); err != nil {
+		return err
+	}
+	s.Camera = string(to)
+	if v, err := json.Marshal(&s); err != nil {
+		return err
+	} else if err = b.Put(to, v); err != nil {
+		return err
+	}
+	return b.Delete(from)
+}
+
+func removeSchedule(tx *bolt.Tx, id []byte) error {
+	return tx.Bucket(schedulesBucketName).Delete(id)
+}
@@ -0,0 +1,262 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	"github.com/empirefox/ic-client-one/ipcam"
+	"github.com/golang/glog"
+)
+
+var (
+	ErrSecretKeyInvalid  = errors.New("secret key must be 32 bytes in hex or base64")
+	ErrSecretKeyEmpty    = errors.New("secret key is empty")
+	ErrSecretKeyRequired = errors.New("value is encrypted but no secret key is set")
+	ErrSecretCorrupted   = errors.New("encrypted value cannot be decrypted")
+	ErrSecretKeyLost     = errors.New("SecretKeyFile required, db has sealed secrets")
+
+	sealedPrefix = []byte("enc1:")
+
+	// set while every secret is sealed with the configured key
+	K_SECRETS_SEALED = []byte("SecretsSealed")
+
+	// system bucket keys that are encrypted at rest
+	secretKeys = [][]byte{K_REG_TOKEN, K_ROOM_TOKEN}
+)
+
+// loadSecret reads the key from SecretKeyFile, or from the environment
+// variable named by SecretKeyEnv. No key configured means no encryption.
+func (setup *Setup) loadSecret() (cipher.AEAD, error) {
+	var raw string
+	switch {
+	case setup.SecretKeyFile != "":
+		if fi, err := os.Stat(setup.SecretKeyFile); err == nil && fi.Mode().Perm()&0077 != 0 {
+			glog.Warningln("secret key file is readable by others:", setup.SecretKeyFile)
+		}
+		b, err := ioutil.ReadFile(setup.SecretKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		raw = string(b)
+	case setup.SecretKeyEnv != "":
+		raw = os.Getenv(setup.SecretKeyEnv)
+	default:
+		return nil, nil
+	}
+
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, ErrSecretKeyEmpty
+	}
+	key, err := hex.DecodeString(raw)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(raw)
+	}
+	if err != nil || len(key) != 32 {
+		return nil, ErrSecretKeyInvalid
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func isSealed(v []byte) bool { return bytes.HasPrefix(v, sealedPrefix) }
+
+func isSecretKey(k []byte) bool {
+	for _, s := range secretKeys {
+		if bytes.Equal(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// urlHasCredentials reports whether a camera url may embed user info.
+// An url that cannot be parsed, like one with a raw % in the password,
+// is treated as having credentials.
+func urlHasCredentials(v []byte) bool {
+	u, err := url.Parse(string(v))
+	return err != nil || u.User != nil || bytes.IndexByte(v, '@') != -1
+}
+
+// ipcamUrlAD binds a sealed url to its ipcam, so it cannot be swapped
+// with the url of another ipcam.
+func ipcamUrlAD(id []byte) []byte {
+	ad := append([]byte(nil), ipcam.K_IC_URL...)
+	ad = append(ad, ':')
+	return append(ad, id...)
+}
+
+// seal encrypts v with k as additional data, so a sealed value
+// cannot be moved to another key. Without key, v is returned as is.
+func (c *Conf) seal(k, v []byte) ([]byte, error) {
+	if c.aead == nil || len(v) == 0 || isSealed(v) {
+		return v, nil
+	}
+	nonce := make([]byte, c.aead.NonceSize(), c.aead.NonceSize()+len(v)+c.aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := c.aead.Seal(nonce, nonce, v, k)
+	out := make([]byte, len(sealedPrefix)+base64.StdEncoding.EncodedLen(len(sealed)))
+	copy(out, sealedPrefix)
+	base64.StdEncoding.Encode(out[len(sealedPrefix):], sealed)
+	return out, nil
+}
+
+// unseal returns plain values unchanged.
+func (c *Conf) unseal(k, v []byte) ([]byte, error) {
+	if !isSealed(v) {
+		return v, nil
+	}
+	if c.aead == nil {
+		return nil, ErrSecretKeyRequired
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(v[len(sealedPrefix):]))
+	if err != nil || len(sealed) < c.aead.NonceSize() {
+		return nil, ErrSecretCorrupted
+	}
+	n := c.aead.NonceSize()
+	plain, err := c.aead.Open(nil, sealed[:n], sealed[n:], k)
+	if err != nil {
+		return nil, ErrSecretCorrupted
+	}
+	return plain, nil
+}
+
+func (c *Conf) sealIpcamUrl(i *ipcam.Ipcam) ([]byte, error) {
+	if !urlHasCredentials([]byte(i.Url)) {
+		return []byte(i.Url), nil
+	}
+	return c.seal(ipcamUrlAD([]byte(i.Id)), []byte(i.Url))
+}
+
+func (c *Conf) unsealIpcamUrl(i *ipcam.Ipcam) {
+	v, err := c.unseal(ipcamUrlAD([]byte(i.Id)), []byte(i.Url))
+	if err != nil {
+		glog.Errorln("ipcam", i.Id, "url:", err)
+		i.Url = ""
+		return
+	}
+	i.Url = string(v)
+}
+
+// rebindIpcamUrls re-seals urls sealed before they were bound to the
+// ipcam id. It needs the key when there is any.
+func (c *Conf) rebindIpcamUrls(tx *bolt.Tx) error {
+	p := tx.Bucket(ipcamsBucketName)
+	return p.ForEach(func(ik, iv []byte) error {
+		b := p.Bucket(ik)
+		if b == nil || !isSealed(b.Get(ipcam.K_IC_URL)) {
+			return nil
+		}
+		v, err := c.unseal(ipcam.K_IC_URL, b.Get(ipcam.K_IC_URL))
+		if err != nil {
+			return fmt.Errorf("ipcam %q url: %v", ik, err)
+		}
+		if v, err = c.seal(ipcamUrlAD(ik), v); err != nil {
+			return err
+		}
+		return b.Put(ipcam.K_IC_URL, v)
+	})
+}
+
+// onSecretKeyChanged seals the plaintext secrets when a key is configured
+// after migration 4. A removed key is forgotten only when nothing sealed is
+// left, otherwise Open fails instead of losing the secrets.
+func (c *Conf) onSecretKeyChanged(tx *bolt.Tx) error {
+	sys := tx.Bucket(sysBucketName)
+	sealed := sys.Get(K_SECRETS_SEALED) != nil
+	switch {
+	case c.aead != nil && !sealed:
+		return c.sealPlaintext(tx)
+	case c.aead == nil && sealed:
+		if hasSealed(tx) {
+			return ErrSecretKeyLost
+		}
+		return sys.Delete(K_SECRETS_SEALED)
+	}
+	return nil
+}
+
+func hasSealed(tx *bolt.Tx) bool {
+	sys := tx.Bucket(sysBucketName)
+	for _, k := range secretKeys {
+		if isSealed(sys.Get(k)) {
+			return true
+		}
+	}
+	found := false
+	p := tx.Bucket(ipcamsBucketName)
+	p.ForEach(func(ik, iv []byte) error {
+		if b := p.Bucket(ik); b != nil && isSealed(b.Get(ipcam.K_IC_URL)) {
+			found = true
+		}
+		return nil
+	})
+	return found
+}
+
+// sealPlaintext encrypts every secret still stored in plain text, it runs
+// in migration 4 and then once each time a key is configured.
+func (c *Conf) sealPlaintext(tx *bolt.Tx) error {
+	if c.aead == nil {
+		return nil
+	}
+	n := 0
+	sys := tx.Bucket(sysBucketName)
+	for _, k := range secretKeys {
+		v := sys.Get(k)
+		if len(v) == 0 || isSealed(v) {
+			continue
+		}
+		sealed, err := c.seal(k, v)
+		if err != nil {
+			return err
+		}
+		if err = sys.Put(k, sealed); err != nil {
+			return err
+		}
+		n++
+	}
+
+	p := tx.Bucket(ipcamsBucketName)
+	err := p.ForEach(func(ik, iv []byte) error {
+		b := p.Bucket(ik)
+		if b == nil {
+			return nil
+		}
+		v := b.Get(ipcam.K_IC_URL)
+		if isSealed(v) || !urlHasCredentials(v) {
+			return nil
+		}
+		sealed, err := c.seal(ipcamUrlAD(ik), v)
+		if err != nil {
+			return err
+		}
+		n++
+		return b.Put(ipcam.K_IC_URL, sealed)
+	})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		glog.Infof("encrypted %d plaintext secrets\n", n)
+	}
+	return sys.Put(K_SECRETS_SEALED, []byte("1"))
+}
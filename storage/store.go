@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"errors"
+
+	. "github.com/empirefox/ic-client-one/ipcam"
+	"github.com/empirefox/ic-client-one/schedule"
+)
+
+// DbPath to keep everything in memory, for tests and demo
+const MEMORY_DB_PATH = ":memory:"
+
+var (
+	ErrIpcamIdRequired = errors.New("ipcam id required")
+)
+
+// Store is the persistent state of the client: system values in Get/Put/Del,
+// ipcams with their history and schedules. Conf is the bolt implementation.
+type Store interface {
+	Get(k []byte) []byte
+	Put(k, v []byte) error
+	Del(k []byte) error
+
+	GetIpcams() Ipcams
+	GetIpcam(id []byte) (Ipcam, error)
+	// target will trigger remove then create new one
+	PutIpcam(i *Ipcam, target ...[]byte) error
+	// PutIpcamStatus saves what is learned from the device, the fields no
+	// operator edits. It neither checks nor bumps Rev.
+	PutIpcamStatus(i *Ipcam) error
+	SetIpcamAttr(id, k, v []byte) error
+	RemoveIpcam(id []byte) error
+	// batches are saved all or nothing, errors are *BatchError
+	SaveIpcams(setters []SetterIpcam) error
+	RemoveIpcams(ids []string) error
+
+	AppendIpcamHistory(id string, hs ...History) error
+	GetIpcamHistory(id string, since int64, limit int) ([]History, error)
+
+	GetSchedules() (schedule.Schedules, error)
+	PutSchedule(s *schedule.Schedule) error
+	RemoveSchedule(id []byte) error
+
+	Close()
+}
+
+var _ Store = (*Conf)(nil)
+var _ Store = (*MemStore)(nil)
+
+func (c *Conf) InMemory() bool { return c.setup.DbPath == MEMORY_DB_PATH }
+
+// OpenStore opens the bolt db, or returns a new MemStore
+// when DbPath is MEMORY_DB_PATH.
+func (c *Conf) OpenStore() (Store, error) {
+	if c.InMemory() {
+		return NewMemStore(int(c.historyKeep())), nil
+	}
+	if err := c.Open(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
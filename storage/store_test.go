@@ -0,0 +1,188 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/empirefox/ic-client-one/ipcam"
+	"github.com/empirefox/ic-client-one/schedule"
+)
+
+// testStore checks the behaviour every Store implementation shares.
+func testStore(t *testing.T, s Store) {
+	if err := s.Put([]byte("a"), []byte("b")); err != nil {
+		t.Errorf("failed to put value, err: %v\n", err)
+	}
+	if v := string(s.Get([]byte("a"))); v != "b" {
+		t.Errorf("failed to get value, got: %q\n", v)
+	}
+	s.Del([]byte("a"))
+	if v := s.Get([]byte("a")); v != nil {
+		t.Errorf("should get nil after delete, got: %q\n", v)
+	}
+
+	if err := s.PutIpcam(&ipcam.Ipcam{Url: "aurl"}); err == nil {
+		t.Errorf("should get error when no id specialed\n")
+	}
+	if err := s.PutIpcam(&ipcam.Ipcam{Id: "aid", Url: "aurl", Width: 640, Online: true, Groups: []string{"g"},
+		Onvif: "http://a:8080/onvif/device_service", Model: "m", Features: []string{"PTZ"}, ProbedAt: 1, Ptz: true}); err != nil {
+		t.Errorf("failed to put ipcam, err: %v\n", err)
+	}
+	i, err := s.GetIpcam([]byte("aid"))
+	if err != nil || i.Url != "aurl" || i.Width != 640 || i.Online || i.UpdatedAt == 0 || !i.InGroup("g") ||
+		i.Onvif != "http://a:8080/onvif/device_service" || i.Model != "m" || !i.HasFeature("PTZ") || i.ProbedAt != 1 || i.Ptz {
+		t.Errorf("should get stored ipcam, got: %+v, err: %v\n", i, err)
+	}
+
+	if err := s.SetIpcamAttr([]byte("aid"), ipcam.K_IC_REC, []byte(strconv.FormatBool(true))); err != nil {
+		t.Errorf("failed to set attr, err: %v\n", err)
+	}
+	if i, _ := s.GetIpcam([]byte("aid")); !i.Rec {
+		t.Errorf("should get changed attr\n")
+	}
+	if err := s.SetIpcamAttr([]byte("none"), ipcam.K_IC_REC, []byte("true")); err == nil {
+		t.Errorf("should get error when setting attr of unknown ipcam\n")
+	}
+
+	s.AppendIpcamHistory("aid", ipcam.History{At: 1, Type: ipcam.HISTORY_ONLINE})
+	if err := s.PutSchedule(&schedule.Schedule{Camera: "none"}); err == nil {
+		t.Errorf("should get error when scheduling unknown ipcam\n")
+	}
+	if err := s.PutSchedule(&schedule.Schedule{Camera: "aid", Windows: []schedule.Window{{Day: 8}}}); err == nil {
+		t.Errorf("should get error when schedule is invalid\n")
+	}
+	win := schedule.Window{Day: time.Monday, Start: "08:00", End: "18:00"}
+	if err := s.PutSchedule(&schedule.Schedule{Camera: "aid", Windows: []schedule.Window{win}}); err != nil {
+		t.Errorf("failed to put schedule, err: %v\n", err)
+	}
+	if err := s.PutIpcam(&ipcam.Ipcam{Id: "bid", Url: "burl"}, []byte("aid")); err != nil {
+		t.Errorf("failed to change ipcam id, err: %v\n", err)
+	}
+	if err := s.PutIpcam(&ipcam.Ipcam{Id: "cid"}, []byte("none")); err == nil {
+		t.Errorf("should get error when target not found\n")
+	}
+	if is := s.GetIpcams(); len(is) != 1 || is["bid"].Url != "burl" {
+		t.Errorf("should only get changed ipcam, got: %v\n", is)
+	}
+	if hs, _ := s.GetIpcamHistory("bid", 0, 0); len(hs) != 1 {
+		t.Errorf("history should follow id change, got: %v\n", hs)
+	}
+	if ss, _ := s.GetSchedules(); len(ss) != 1 || ss["bid"].Camera != "bid" || ss["bid"].Windows[0] != win {
+		t.Errorf("schedule should follow id change, got: %v\n", ss)
+	}
+
+	if err := s.RemoveIpcam([]byte("aid")); err == nil {
+		t.Errorf("should get error when remove non-exist ipcam\n")
+	}
+	if err := s.RemoveIpcam([]byte("bid")); err != nil {
+		t.Errorf("failed to remove ipcam, err: %v\n", err)
+	}
+	if _, err := s.GetIpcam([]byte("bid")); err == nil {
+		t.Errorf("should get error after removing\n")
+	}
+	if hs, _ := s.GetIpcamHistory("bid", 0, 0); len(hs) != 0 {
+		t.Errorf("history should be removed with ipcam\n")
+	}
+	if ss, _ := s.GetSchedules(); len(ss) != 0 {
+		t.Errorf("schedule should be removed with ipcam\n")
+	}
+}
+
+func TestStore_Bolt(t *testing.T) {
+	c := NewTestConf()
+	defer c.Close()
+	testStore(t, c.Conf)
+}
+
+func TestStore_Mem(t *testing.T) {
+	s := NewMemStore(0)
+	defer s.Close()
+	testStore(t, s)
+
+	for at := int64(1); at <= HISTORY_KEEP+1; at++ {
+		s.AppendIpcamHistory("x", ipcam.History{At: at})
+	}
+	if hs, _ := s.GetIpcamHistory("x", 0, 0); len(hs) != HISTORY_KEEP || hs[0].At != HISTORY_KEEP+1 {
+		t.Errorf("should keep newest HISTORY_KEEP entries, got: %d\n", len(hs))
+	}
+}
+
+func TestConf_OpenStoreMemory(t *testing.T) {
+	c, err := NewConf(fmt.Sprintf(jsonContent, MEMORY_DB_PATH))
+	if err != nil {
+		t.Fatalf("NewConf failed, err: %v\n", err)
+	}
+	s, err := c.OpenStore()
+	if err != nil {
+		t.Fatalf("OpenStore failed, err: %v\n", err)
+	}
+	defer s.Close()
+	if _, ok := s.(*MemStore); !ok {
+		t.Errorf("should open memory store for %s\n", MEMORY_DB_PATH)
+	}
+}
+
+func testStoreConflict(t *testing.T, s Store) {
+	i := &ipcam.Ipcam{Id: "aid", Url: "aurl"}
+	if err := s.PutIpcam(i); err != nil || i.Rev != 1 {
+		t.Fatalf("first put should get rev 1, got: %d, err: %v\n", i.Rev, err)
+	}
+	seen := i.Rev
+
+	if err := s.PutIpcam(&ipcam.Ipcam{Id: "aid", Url: "a2", Rev: seen}); err != nil {
+		t.Errorf("put with current rev should succeed, err: %v\n", err)
+	}
+	if err := s.PutIpcam(&ipcam.Ipcam{Id: "aid", Url: "a3", Rev: seen}); err != ErrIpcamConflict {
+		t.Errorf("put with stale rev should conflict, err: %v\n", err)
+	}
+	if err := s.PutIpcam(&ipcam.Ipcam{Id: "bid", Url: "a3", Rev: seen + 1}, []byte("aid")); err != nil {
+		t.Errorf("rename with current rev should succeed, err: %v\n", err)
+	}
+	s.SetIpcamAttr([]byte("bid"), ipcam.K_IC_OFF, []byte("true"))
+	if cur, _ := s.GetIpcam([]byte("bid")); cur.Url != "a3" || cur.Rev != seen+3 {
+		t.Errorf("every change should bump rev, got: %+v\n", cur)
+	}
+	if err := s.PutIpcam(&ipcam.Ipcam{Id: "bid", Url: "a4"}); err != nil {
+		t.Errorf("rev 0 should overwrite, err: %v\n", err)
+	}
+	if err := s.PutIpcam(&ipcam.Ipcam{Id: "none", Rev: 1}); err != ErrIpcamConflict {
+		t.Errorf("put with rev to removed ipcam should conflict, err: %v\n", err)
+	}
+}
+
+// a status write between an operator's get and set is not a conflict
+func testStoreStatusNoConflict(t *testing.T, s Store) {
+	s.PutIpcam(&ipcam.Ipcam{Id: "aid", Url: "aurl"})
+	seen, _ := s.GetIpcam([]byte("aid"))
+
+	status := seen
+	status.HasVideo, status.Width, status.Model = true, 640, "m"
+	if err := s.PutIpcamStatus(&status); err != nil {
+		t.Errorf("failed to put status, err: %v\n", err)
+	}
+	if cur, _ := s.GetIpcam([]byte("aid")); cur.Rev != seen.Rev || !cur.HasVideo || cur.Width != 640 || cur.Model != "m" {
+		t.Errorf("status write should save status and keep rev, got: %+v\n", cur)
+	}
+	if err := s.PutIpcam(&ipcam.Ipcam{Id: "aid", Url: "a2", Rev: seen.Rev}); err != nil {
+		t.Errorf("operator save after status write should succeed, err: %v\n", err)
+	}
+	if err := s.PutIpcamStatus(&ipcam.Ipcam{Id: "none"}); err != ErrIpcamNotFound {
+		t.Errorf("status of unknown ipcam should get ErrIpcamNotFound, err: %v\n", err)
+	}
+}
+
+func TestStore_Conflict(t *testing.T) {
+	c := NewTestConf()
+	defer c.Close()
+	testStoreConflict(t, c.Conf)
+	testStoreConflict(t, NewMemStore(0))
+}
+
+func TestStore_StatusNoConflict(t *testing.T) {
+	c := NewTestConf()
+	defer c.Close()
+	testStoreStatusNoConflict(t, c.Conf)
+	testStoreStatusNoConflict(t, NewMemStore(0))
+}
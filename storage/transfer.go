@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/boltdb/bolt"
+	. "github.com/empirefox/ic-client-one/ipcam"
+	"github.com/golang/glog"
+)
+
+const IPCAMS_EXPORT_VERSION = 1
+
+var (
+	ErrImportVersion = errors.New("unsupported ipcams export version")
+	ErrImportMode    = errors.New("import mode must be merge or replace")
+
+	errDryRun = errors.New("dry run")
+)
+
+type ImportMode string
+
+const (
+	// ImportMerge adds new ipcams and overwrites the ones with the same id.
+	ImportMerge ImportMode = "merge"
+	// ImportReplace also removes every ipcam that is not in the import.
+	ImportReplace ImportMode = "replace"
+)
+
+type IpcamsExport struct {
+	Version    int
+	ExportedAt int64
+	Ipcams     []Ipcam
+}
+
+type ImportResult struct {
+	Added   []string
+	Updated []string
+	Removed []string
+}
+
+func (r *ImportResult) String() string {
+	return fmt.Sprintf("added: %d, updated: %d, removed: %d", len(r.Added), len(r.Updated), len(r.Removed))
+}
+
+// ExportIpcams writes every ipcam as indented json, sorted by id.
+// Runtime only fields like Online are not exported.
+func (c *Conf) ExportIpcams(w io.Writer) error {
+	is := c.GetIpcams()
+	ex := IpcamsExport{
+		Version:    IPCAMS_EXPORT_VERSION,
+		ExportedAt: time.Now().Unix(),
+		Ipcams:     make([]Ipcam, 0, len(is)),
+	}
+	for _, i := range is {
+		i.Online = false
+		ex.Ipcams = append(ex.Ipcams, i)
+	}
+	sort.Sort(byId(ex.Ipcams))
+
+	b, err := json.MarshalIndent(&ex, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// ImportIpcams applies an export in one transaction.
+// With dryRun, the changes are computed and rolled back.
+func (c *Conf) ImportIpcams(r io.Reader, mode ImportMode, dryRun bool) (*ImportResult, error) {
+	if mode != ImportMerge && mode != ImportReplace {
+		return nil, ErrImportMode
+	}
+	var ex IpcamsExport
+	if err := json.NewDecoder(r).Decode(&ex); err != nil {
+		return nil, err
+	}
+	if ex.Version != IPCAMS_EXPORT_VERSION {
+		return nil, ErrImportVersion
+	}
+	seen := make(map[string]bool, len(ex.Ipcams))
+	for _, i := range ex.Ipcams {
+		if i.Id == "" {
+			return nil, fmt.Errorf("ipcam with url %q has no id", i.Url)
+		}
+		if seen[i.Id] {
+			return nil, fmt.Errorf("duplicate ipcam id %q", i.Id)
+		}
+		seen[i.Id] = true
+	}
+
+	result := new(ImportResult)
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		p := tx.Bucket(ipcamsBucketName)
+		if mode == ImportReplace {
+			var removed [][]byte
+			p.ForEach(func(ik, iv []byte) error {
+				if iv == nil && !seen[string(ik)] {
+					removed = append(removed, append([]byte(nil), ik...))
+				}
+				return nil
+			})
+			for _, id := range removed {
+				if err := p.DeleteBucket(id); err != nil {
+					return err
+				}
+				if err := removeHistory(tx, id); err != nil {
+					return err
+				}
+				if err := removeSchedule(tx, id); err != nil {
+					return err
+				}
+				result.Removed = append(result.Removed, string(id))
+			}
+		}
+		for k := range ex.Ipcams {
+			i := &ex.Ipcams[k]
+			// import always overwrites
+			i.Online, i.Rev = false, 0
+			if p.Bucket([]byte(i.Id)) == nil {
+				result.Added = append(result.Added, i.Id)
+			} else {
+				result.Updated = append(result.Updated, i.Id)
+			}
+			if err := c.putIpcam(p, i, nil); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && err != errDryRun {
+		glog.Errorln(err)
+		return nil, err
+	}
+	if !dryRun {
+		glog.Infoln("ipcams imported,", result)
+	}
+	return result, nil
+}
+
+type byId []Ipcam
+
+func (is byId) Len() int           { return len(is) }
+func (is byId) Swap(i, j int)      { is[i], is[j] = is[j], is[i] }
+func (is byId) Less(i, j int) bool { return is[i].Id < is[j].Id }
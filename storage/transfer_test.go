@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/empirefox/ic-client-one/ipcam"
+)
+
+func TestConf_ExportImportIpcams(t *testing.T) {
+	src := NewTestConf()
+	defer src.Close()
+	src.PutIpcam(&ipcam.Ipcam{Id: "a", Url: "aurl", Rec: true})
+	src.PutIpcam(&ipcam.Ipcam{Id: "b", Url: "burl", Width: 640})
+
+	var buf bytes.Buffer
+	if err := src.ExportIpcams(&buf); err != nil {
+		t.Fatalf("export failed, err: %v\n", err)
+	}
+	var ex IpcamsExport
+	if err := json.Unmarshal(buf.Bytes(), &ex); err != nil {
+		t.Fatalf("export should be valid json, err: %v\n", err)
+	}
+	if len(ex.Ipcams) != 2 || ex.Ipcams[0].Id != "a" || ex.Ipcams[1].Id != "b" {
+		t.Errorf("export should contain sorted ipcams, got: %v\n", ex.Ipcams)
+	}
+
+	dst := NewTestConf()
+	defer dst.Close()
+	dst.PutIpcam(&ipcam.Ipcam{Id: "b", Url: "old"})
+	dst.PutIpcam(&ipcam.Ipcam{Id: "c", Url: "curl"})
+
+	r, err := dst.ImportIpcams(bytes.NewReader(buf.Bytes()), ImportMerge, true)
+	if err != nil {
+		t.Fatalf("dry run failed, err: %v\n", err)
+	}
+	if len(r.Added) != 1 || len(r.Updated) != 1 || len(r.Removed) != 0 {
+		t.Errorf("unexpected dry run result: %+v\n", r)
+	}
+	if i, _ := dst.GetIpcam([]byte("b")); i.Url != "old" {
+		t.Errorf("dry run should not change ipcams\n")
+	}
+
+	if _, err := dst.ImportIpcams(bytes.NewReader(buf.Bytes()), ImportMerge, false); err != nil {
+		t.Fatalf("merge failed, err: %v\n", err)
+	}
+	if is := dst.GetIpcams(); len(is) != 3 || is["b"].Url != "burl" || !is["a"].Rec {
+		t.Errorf("merge should keep c and overwrite b, got: %v\n", is)
+	}
+
+	r, err = dst.ImportIpcams(bytes.NewReader(buf.Bytes()), ImportReplace, false)
+	if err != nil {
+		t.Fatalf("replace failed, err: %v\n", err)
+	}
+	if len(r.Removed) != 1 || r.Removed[0] != "c" {
+		t.Errorf("replace should remove c, got: %+v\n", r)
+	}
+	if is := dst.GetIpcams(); len(is) != 2 || is["b"].Width != 640 {
+		t.Errorf("replace should leave exported ipcams only, got: %v\n", is)
+	}
+}
+
+func TestConf_ImportIpcamsInvalid(t *testing.T) {
+	c := NewTestConf()
+	defer c.Close()
+
+	cases := []string{
+		`{"Version":1,"Ipcams":[{"Url":"noid"}]}`,
+		`{"Version":1,"Ipcams":[{"Id":"a"},{"Id":"a"}]}`,
+		`{"Version":99,"Ipcams":[]}`,
+		`not json`,
+	}
+	for _, content := range cases {
+		if _, err := c.ImportIpcams(bytes.NewReader([]byte(content)), ImportMerge, false); err == nil {
+			t.Errorf("should get error when importing %s\n", content)
+		}
+	}
+	if _, err := c.ImportIpcams(bytes.NewReader([]byte(`{"Version":1}`)), "bad", false); err != ErrImportMode {
+		t.Errorf("should reject unknown mode, err: %v\n", err)
+	}
+}
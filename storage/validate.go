@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+var (
+	ErrWsUrlScheme     = errors.New("WsUrl must be a ws:// or wss:// url")
+	ErrIceUrl          = errors.New("must be host[:port] or a stun:, stuns:, turn:, turns: uri")
+	ErrDbDirNotFound   = errors.New("directory of DbPath does not exist")
+	ErrRecDirNotDir    = errors.New("RecDir is not a directory")
+	ErrRecDirReadOnly  = errors.New("RecDir is not writable")
+	ErrBackupKeep      = errors.New("BackupKeep must not be negative")
+	ErrSecretKeyFile   = errors.New("SecretKeyFile cannot be read")
+	ErrWsUrlInsecure   = errors.New("ws:// is not encrypted, use wss:// for remote servers")
+	ErrRecQuota        = errors.New("must not be negative")
+	ErrRetentionSecond = errors.New("RetentionSecond must greater than 60")
+	ErrRecordsAuth     = errors.New("RecordsUser and RecordsPassword must be set together")
+	ErrDiskOk          = errors.New("DiskOkMB must not be less than DiskLowMB")
+	ErrEventMax        = errors.New("EventMaxSecond must not be less than EventPostSecond")
+	ErrRetryMax        = errors.New("RetryMaxSecond must not be less than RetryBaseSecond")
+	ErrRetryJitter     = errors.New("RetryJitter must be in [0, 1)")
+	ErrDiskCheckSecond = errors.New("DiskCheckSecond must greater than 10")
+	// minted credentials expire, and the conductor cannot replace the
+	// ice servers it was given to renew them
+	ErrIceSharedSecret = errors.New("SharedSecret is not supported by the conductor, use Username and Credential")
+)
+
+type SetupProblem struct {
+	// path like "IceServers[1].Urls[0]"
+	Field   string
+	Err     error
+	Warning bool
+}
+
+func (p *SetupProblem) String() string {
+	level := "error"
+	if p.Warning {
+		level = "warning"
+	}
+	return fmt.Sprintf("%s %s: %v", level, p.Field, p.Err)
+}
+
+type SetupReport struct {
+	Problems []SetupProblem
+}
+
+func (r *SetupReport) error(field string, err error) {
+	r.Problems = append(r.Problems, SetupProblem{Field: field, Err: err})
+}
+
+func (r *SetupReport) warn(field string, err error) {
+	r.Problems = append(r.Problems, SetupProblem{Field: field, Err: err, Warning: true})
+}
+
+func (r *SetupReport) Errors() (ps []SetupProblem) {
+	for _, p := range r.Problems {
+		if !p.Warning {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+func (r *SetupReport) Warnings() (ps []SetupProblem) {
+	for _, p := range r.Problems {
+		if p.Warning {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// Err returns nil when there are only warnings.
+func (r *SetupReport) Err() error {
+	if ps := r.Errors(); len(ps) != 0 {
+		return &SetupError{ps}
+	}
+	return nil
+}
+
+// SetupError holds every error of a setup.
+// errors.Is matches any of them, like ErrWsUrlRequired.
+type SetupError struct {
+	Problems []SetupProblem
+}
+
+func (e *SetupError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i := range e.Problems {
+		msgs[i] = e.Problems[i].String()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *SetupError) Is(target error) bool {
+	for _, p := range e.Problems {
+		if p.Err == target {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate expands the env in paths, then checks every field.
+// Warnings are logged only.
+func (setup *Setup) Validate() error {
+	r := setup.Check()
+	for _, p := range r.Warnings() {
+		glog.Warningln("setup", p.String())
+	}
+	return r.Err()
+}
+
+// Check expands the env in paths, and gathers every problem of setup.
+func (setup *Setup) Check() *SetupReport {
+	setup.DbPath = os.ExpandEnv(setup.DbPath)
+	setup.RecDir = os.ExpandEnv(setup.RecDir)
+	setup.SecretKeyFile = os.ExpandEnv(setup.SecretKeyFile)
+	setup.BackupDir = os.ExpandEnv(setup.BackupDir)
+
+	r := new(SetupReport)
+	setup.checkWsUrl(r)
+
+	if setup.PingSecond < 30 {
+		r.error("PingSecond", ErrPingSecond)
+	} else if setup.PingSecond > 600 {
+		r.warn("PingSecond", errors.New("over 600, the server may drop the idle connection"))
+	}
+
+	switch setup.DbPath {
+	case "":
+		r.error("DbPath", ErrDbPathRequired)
+	case MEMORY_DB_PATH:
+		r.warn("DbPath", errors.New("in memory, nothing will be saved"))
+	default:
+		if fi, err := os.Stat(filepath.Dir(setup.DbPath)); err != nil || !fi.IsDir() {
+			r.error("DbPath", ErrDbDirNotFound)
+		}
+	}
+
+	if setup.RecDir == "" {
+		r.error("RecDir", ErrRecDirRequired)
+	} else {
+		checkRecDir(r, setup.RecDir)
+	}
+
+	seen := make(map[string]bool)
+	for i, stun := range setup.Stuns {
+		field := fmt.Sprintf("Stuns[%d]", i)
+		if err := checkIceUrl(stun); err != nil {
+			r.error(field, err)
+		}
+		if seen[stun] {
+			r.warn(field, errors.New("duplicated"))
+		}
+		seen[stun] = true
+	}
+	for i := range setup.IceServers {
+		s := &setup.IceServers[i]
+		field := fmt.Sprintf("IceServers[%d]", i)
+		if err := s.validate(); err != nil {
+			r.error(field, err)
+		}
+		for j, u := range s.Urls {
+			if err := checkIceUrl(u); err != nil {
+				r.error(fmt.Sprintf("%s.Urls[%d]", field, j), err)
+			}
+		}
+		if s.SharedSecret != "" {
+			r.error(field+".SharedSecret", ErrIceSharedSecret)
+		}
+	}
+
+	if setup.SecretKeyFile != "" {
+		if _, err := ioutil.ReadFile(setup.SecretKeyFile); err != nil {
+			r.error("SecretKeyFile", ErrSecretKeyFile)
+		}
+		if setup.SecretKeyEnv != "" {
+			r.warn("SecretKeyEnv", errors.New("ignored when SecretKeyFile is set"))
+		}
+	}
+
+	if setup.BackupDir != "" && setup.BackupSecond < 60 {
+		r.error("BackupSecond", ErrBackupSecond)
+	}
+	if setup.BackupKeep < 0 {
+		r.error("BackupKeep", ErrBackupKeep)
+	}
+	if setup.BackupDir == "" && setup.BackupSecond > 0 {
+		r.warn("BackupSecond", errors.New("ignored without BackupDir"))
+	}
+	if setup.HistoryKeep < 0 {
+		r.warn("HistoryKeep", fmt.Errorf("negative, %d is used", HISTORY_KEEP))
+	}
+	setup.checkRetention(r)
+
+	if setup.DiskLowMB < 0 || setup.DiskOkMB < 0 {
+		r.error("DiskLowMB", ErrRecQuota)
+	} else if setup.DiskOkMB != 0 && setup.DiskOkMB < setup.DiskLowMB {
+		r.error("DiskOkMB", ErrDiskOk)
+	}
+	if setup.DiskCheckSecond != 0 && setup.DiskCheckSecond < 10 {
+		r.error("DiskCheckSecond", ErrDiskCheckSecond)
+	}
+	if setup.EventPreSecond < 0 || setup.EventPostSecond < 0 || setup.EventMaxSecond < 0 {
+		r.error("EventPostSecond", ErrRecQuota)
+	} else if setup.EventMaxSecond != 0 && setup.EventMaxSecond < setup.EventPostSecond {
+		r.error("EventMaxSecond", ErrEventMax)
+	}
+	if setup.RetryBaseSecond < 0 || setup.RetryMaxSecond < 0 {
+		r.error("RetryBaseSecond", ErrRecQuota)
+	} else if setup.RetryMaxSecond != 0 && setup.RetryMaxSecond < setup.RetryBaseSecond {
+		r.error("RetryMaxSecond", ErrRetryMax)
+	}
+	if setup.RetryJitter < 0 || setup.RetryJitter >= 1 {
+		r.error("RetryJitter", ErrRetryJitter)
+	}
+	if (setup.RecordsUser == "") != (setup.RecordsPassword == "") {
+		r.error("RecordsPassword", ErrRecordsAuth)
+	} else if setup.RecordsPassword != "" && len(setup.RecordsPassword) < 8 {
+		r.warn("RecordsPassword", errors.New("shorter than 8 chars"))
+	}
+	return r
+}
+
+func (setup *Setup) checkRetention(r *SetupReport) {
+	quotas := map[string]int64{
+		"RecKeepHour":    int64(setup.RecKeepHour),
+		"RecCameraMaxMB": setup.RecCameraMaxMB,
+		"RecMaxMB":       setup.RecMaxMB,
+		"RecMinFreeMB":   setup.RecMinFreeMB,
+	}
+	enabled := false
+	for _, field := range []string{"RecKeepHour", "RecCameraMaxMB", "RecMaxMB", "RecMinFreeMB"} {
+		if quotas[field] < 0 {
+			r.error(field, ErrRecQuota)
+		}
+		enabled = enabled || quotas[field] > 0
+	}
+	if setup.RetentionSecond != 0 && setup.RetentionSecond < 60 {
+		r.error("RetentionSecond", ErrRetentionSecond)
+	}
+	if !enabled && setup.RetentionSecond > 0 {
+		r.warn("RetentionSecond", errors.New("ignored without any Rec quota"))
+	}
+	if setup.RecCameraMaxMB > 0 && setup.RecMaxMB > 0 && setup.RecCameraMaxMB > setup.RecMaxMB {
+		r.warn("RecCameraMaxMB", errors.New("greater than RecMaxMB"))
+	}
+}
+
+func (setup *Setup) checkWsUrl(r *SetupReport) {
+	if setup.WsUrl == "" {
+		r.error("WsUrl", ErrWsUrlRequired)
+		return
+	}
+	u, err := url.Parse(setup.WsUrl)
+	if err != nil || (u.Scheme != "ws" && u.Scheme != "wss") || u.Host == "" {
+		r.error("WsUrl", ErrWsUrlScheme)
+		return
+	}
+	if strings.HasSuffix(u.Path, "/") {
+		r.warn("WsUrl", errors.New("trailing slash, paths are appended to it"))
+	}
+	if u.Scheme == "ws" && !isLocalHost(u.Host) {
+		r.warn("WsUrl", ErrWsUrlInsecure)
+	}
+}
+
+func isLocalHost(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	if ip.IsLoopback() {
+		return true
+	}
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"} {
+		_, n, _ := net.ParseCIDR(cidr)
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIceUrl accepts "host", "host:port" and "stun:host:port?transport=udp" forms.
+func checkIceUrl(s string) error {
+	hostport := s
+	for _, scheme := range []string{"stun:", "stuns:", "turn:", "turns:"} {
+		if strings.HasPrefix(s, scheme) {
+			hostport = strings.TrimPrefix(s, scheme)
+			if i := strings.IndexByte(hostport, '?'); i != -1 {
+				hostport = hostport[:i]
+			}
+			break
+		}
+	}
+	if hostport == "" || strings.ContainsAny(hostport, "/ ") {
+		return ErrIceUrl
+	}
+	host, port, err := net.SplitHostPort(hostport)
+	if err != nil {
+		// no port
+		if strings.Contains(hostport, ":") && net.ParseIP(hostport) == nil {
+			return ErrIceUrl
+		}
+		return nil
+	}
+	if host == "" {
+		return ErrIceUrl
+	}
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return ErrIceUrl
+	}
+	return nil
+}
+
+// checkRecDir writes and removes a probe file when RecDir exists.
+func checkRecDir(r *SetupReport, dir string) {
+	fi, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		r.warn("RecDir", errors.New("does not exist yet"))
+		return
+	}
+	if err != nil {
+		r.error("RecDir", err)
+		return
+	}
+	if !fi.IsDir() {
+		r.error("RecDir", ErrRecDirNotDir)
+		return
+	}
+	f, err := ioutil.TempFile(dir, ".ic-client-one-probe-")
+	if err != nil {
+		r.error("RecDir", ErrRecDirReadOnly)
+		return
+	}
+	f.Close()
+	os.Remove(f.Name())
+}
@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func hasProblem(r *SetupReport, field string, warning bool) bool {
+	for _, p := range r.Problems {
+		if p.Field == field && p.Warning == warning {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSetup_CheckGathersAll(t *testing.T) {
+	setup := Setup{
+		DbPath:     "/no/such/dir/ic-room.db",
+		RecDir:     "",
+		WsUrl:      "http://example.com",
+		PingSecond: 10,
+		Stuns:      []string{"stun.ekiga.net", "stun:a.b:3478", "bad host", "a.b:99999", "stun.ekiga.net"},
+		IceServers: []IceServer{{Urls: []string{"turn:"}, SharedSecret: "s"}},
+	}
+	r := setup.Check()
+
+	for _, field := range []string{"WsUrl", "PingSecond", "DbPath", "RecDir", "Stuns[2]", "Stuns[3]", "IceServers[0].Urls[0]",
+		"IceServers[0].SharedSecret"} {
+		if !hasProblem(r, field, false) {
+			t.Errorf("should report error of %s, got: %v\n", field, r.Problems)
+		}
+	}
+	if !hasProblem(r, "Stuns[4]", true) {
+		t.Errorf("should warn about duplicated stun\n")
+	}
+	if hasProblem(r, "Stuns[0]", false) || hasProblem(r, "Stuns[1]", false) {
+		t.Errorf("should accept valid stuns\n")
+	}
+
+	err := setup.Validate()
+	if !errors.Is(err, ErrPingSecond) || !errors.Is(err, ErrRecDirRequired) || !errors.Is(err, ErrWsUrlScheme) {
+		t.Errorf("Validate should return every error, got: %v\n", err)
+	}
+}
+
+func TestSetup_CheckDirs(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "ic-client-one-validate-")
+	defer os.RemoveAll(dir)
+
+	setup := Setup{
+		DbPath:     filepath.Join(dir, "ic-room.db"),
+		RecDir:     dir,
+		WsUrl:      "ws://8.8.8.8:9998",
+		PingSecond: 50,
+	}
+	r := setup.Check()
+	if err := r.Err(); err != nil {
+		t.Errorf("should be valid, err: %v\n", err)
+	}
+	if !hasProblem(r, "WsUrl", true) {
+		t.Errorf("should warn about unencrypted remote ws\n")
+	}
+
+	setup.RecDir = setup.DbPath
+	ioutil.WriteFile(setup.DbPath, nil, FILE_MODE)
+	if r = setup.Check(); !hasProblem(r, "RecDir", false) {
+		t.Errorf("should report RecDir is a file\n")
+	}
+
+	setup.RecDir = filepath.Join(dir, "missing")
+	if r = setup.Check(); !hasProblem(r, "RecDir", true) || r.Err() != nil {
+		t.Errorf("should only warn about missing RecDir, got: %v\n", r.Problems)
+	}
+}